@@ -0,0 +1,147 @@
+package analytics
+
+import (
+	"sort"
+	"strings"
+)
+
+// Group is one combination of group key values and its tickets'
+// counts
+type Group struct {
+	Values []string // one per group key, in the order asked for
+	Count  int
+	Open   int
+
+	totalHours float64
+	resolved   int
+}
+
+// NewGroup returns a group counted elsewhere, such as in a database:
+// resolved of its tickets took totalHours between them to resolve
+func NewGroup(values []string, count, open, resolved int, totalHours float64) *Group {
+	return &Group{Values: values, Count: count, Open: open, resolved: resolved, totalHours: totalHours}
+}
+
+// groupKeys are the single-valued keys group_by accepts; see also
+// listGroupKeys
+var groupKeys = map[string]func(a *Analyzer, t Ticket) string{
+	"category":      func(a *Analyzer, t Ticket) string { return t.Category },
+	"priority":      func(a *Analyzer, t Ticket) string { return t.Priority },
+	"status":        func(a *Analyzer, t Ticket) string { return t.Status },
+	"assignee":      func(a *Analyzer, t Ticket) string { return t.Assignee },
+	"created_day":   func(a *Analyzer, t Ticket) string { return t.CreatedAt.In(a.location).Format(DateLayout) },
+	"created_week":  func(a *Analyzer, t Ticket) string { return a.StartOfWeek(t.CreatedAt).Format(DateLayout) },
+	"created_month": func(a *Analyzer, t Ticket) string { return t.CreatedAt.In(a.location).Format("2006-01") },
+}
+
+// listGroupKeys are group keys with any number of values per ticket. A
+// ticket counts once under each of its values, or under "" with none.
+var listGroupKeys = map[string]func(Ticket) []string{
+	"tag": func(t Ticket) []string { return t.Tags },
+}
+
+// BuiltinGroupKey reports whether k is in groupKeys or listGroupKeys
+func BuiltinGroupKey(k string) bool {
+	_, ok := groupKeys[k]
+	_, list := listGroupKeys[k]
+	return ok || list
+}
+
+// IsGroupKey reports whether k is a built-in group key or names a computed
+// field
+func (a *Analyzer) IsGroupKey(k string) bool {
+	return BuiltinGroupKey(k) || inList(a.computedFields, k)
+}
+
+// groupValues returns the ticket's values for the group key k
+func (a *Analyzer) groupValues(k string, t Ticket) []string {
+	if fn, ok := listGroupKeys[k]; ok {
+		if values := fn(t); len(values) > 0 {
+			return values
+		}
+		return []string{""}
+	}
+	if fn, ok := groupKeys[k]; ok {
+		return []string{fn(a, t)}
+	}
+	return []string{t.Fields[k]}
+}
+
+// GroupKeyNames lists the group keys accepted by group_by, sorted
+func (a *Analyzer) GroupKeyNames() string {
+	keys := make([]string, 0, len(groupKeys)+len(listGroupKeys)+len(a.computedFields))
+	for k := range groupKeys {
+		keys = append(keys, k)
+	}
+	for k := range listGroupKeys {
+		keys = append(keys, k)
+	}
+	keys = append(keys, a.computedFields...)
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
+// Aggregate groups t by the values of the by keys, which must all pass
+// IsGroupKey. Groups come back largest first, ties in key order.
+func (a *Analyzer) Aggregate(t []Ticket, by []string) []*Group {
+	index := make(map[string]*Group)
+	var groups []*Group
+	for _, ticket := range t {
+		// Every combination of the ticket's values, one per list value
+		combos := [][]string{{}}
+		for _, k := range by {
+			var next [][]string
+			for _, c := range combos {
+				for _, v := range a.groupValues(k, ticket) {
+					next = append(next, append(append([]string{}, c...), v))
+				}
+			}
+			combos = next
+		}
+		hours, resolved := a.ResolutionHours(ticket)
+		for _, values := range combos {
+			id := strings.Join(values, "\x00")
+			g := index[id]
+			if g == nil {
+				g = &Group{Values: values}
+				index[id] = g
+				groups = append(groups, g)
+			}
+			g.Count++
+			if !a.IsClosed(ticket) {
+				g.Open++
+			}
+			if resolved {
+				g.totalHours += hours
+				g.resolved++
+			}
+		}
+	}
+	SortGroups(groups)
+	return groups
+}
+
+// SortGroups orders groups largest first, ties by their values in key
+// order, as Aggregate returns them
+func SortGroups(groups []*Group) {
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		for k := range groups[i].Values {
+			if groups[i].Values[k] != groups[j].Values[k] {
+				return groups[i].Values[k] < groups[j].Values[k]
+			}
+		}
+		return false
+	})
+}
+
+// AvgHours is the group's mean resolution time, nil before any resolve
+func (g *Group) AvgHours() *float64 {
+	if g.resolved == 0 {
+		return nil
+	}
+	avg := g.totalHours / float64(g.resolved)
+	return &avg
+}
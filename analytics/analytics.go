@@ -0,0 +1,240 @@
+// Package analytics computes LogLens's ticket statistics. It has no HTTP
+// or file handling of its own, so a program with its own []Ticket can call
+// Compute for the same Summary the server's /api/summary returns:
+//
+//	a := analytics.New(analytics.DefaultSettings())
+//	s := a.Compute(tickets, analytics.Options{})
+//
+// The settings belong to the Analyzer, so one program can compute
+// summaries under several.
+package analytics
+
+import (
+	"time"
+)
+
+// DateLayout is the format of the dates summaries bucket tickets by
+const DateLayout = "2006-01-02"
+
+// Ticket represents a single row from the CSV
+type Ticket struct {
+	ID        int        `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ClosedAt  *time.Time `json:"closed_at"` // nil if still open
+	Category  string     `json:"category"`
+	Priority  string     `json:"priority"`
+	Status    string     `json:"status"`
+
+	// Optional columns; nil when the CSV doesn't provide them
+	Reassignments *int `json:"reassignment_count,omitempty"`
+	Reopens       *int `json:"reopened_count,omitempty"`
+	// FirstResponseAt is when the ticket was first responded to
+	FirstResponseAt *time.Time `json:"first_response_at,omitempty"`
+	// Assignee is empty when the CSV has no assignee column
+	Assignee string `json:"assignee,omitempty"`
+	// Tags come from the semicolon-separated tags column, if any, lower-cased
+	Tags []string `json:"tags,omitempty"`
+
+	// History is the ticket's status changes from -status-history, oldest
+	// first; nil without one
+	History []StatusChange `json:"-"`
+
+	// Fields holds the values of the computed fields (-computed-fields),
+	// by name; nil without any
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Alert describes a threshold that the loaded data currently exceeds
+type Alert struct {
+	Type      string    `json:"type"`
+	Message   string    `json:"message"`
+	Threshold int       `json:"threshold"`
+	Value     int       `json:"value"`
+	RaisedAt  time.Time `json:"raised_at"`
+	// Rule and Project name the -alert-rules rule that raised the alert
+	Rule    string `json:"rule,omitempty"`
+	Project string `json:"project,omitempty"`
+}
+
+// Settings are the analysis options the server takes as flags; the flag
+// each mirrors is named alongside
+type Settings struct {
+	Location  *time.Location // -timezone
+	WeekStart time.Weekday   // -week-start
+	// Granularity is the period-over-period unit: day, week or month
+	Granularity string
+	// AsOf is the reference time for ages and trailing windows; zero
+	// means the wall clock
+	AsOf time.Time
+	// OpenRule is what makes a ticket closed: closedat, status or both
+	OpenRule       string
+	ClosedStatuses []string
+	// SLATargets maps lower-cased priority to its resolution target
+	SLATargets         map[string]time.Duration
+	UrgentPriorities   []string
+	UrgentLimit        int
+	AtRiskFraction     float64
+	CapResolutionHours float64       // 0 disables the cap
+	MaxIngestGap       time.Duration // 0 disables ingest_stalled
+
+	// BaselineStart and BaselineEnd bound resolution_vs_baseline's window,
+	// [start, end); zero disables it. BaselineFrom and BaselineTo are the
+	// bounds as the user gave them, echoed in the summary.
+	BaselineStart, BaselineEnd time.Time
+	BaselineFrom, BaselineTo   string
+
+	AnomalyWindow int
+	AnomalySigma  float64
+	AnomalyMethod string // one of AnomalyMethods
+
+	// CurrentAlert fills the summary's alert; nil leaves it empty
+	CurrentAlert func() *Alert
+
+	// ComputedFields names the tickets' Fields, which become group keys
+	ComputedFields []string
+}
+
+// DefaultSettings returns the settings of a server started without flags
+func DefaultSettings() Settings {
+	return Settings{
+		Location:       time.UTC,
+		WeekStart:      time.Monday,
+		Granularity:    "week",
+		OpenRule:       "closedat",
+		ClosedStatuses: []string{"Closed", "Resolved", "Done"},
+		SLATargets: map[string]time.Duration{
+			"high": 24 * time.Hour, "medium": 72 * time.Hour, "low": 168 * time.Hour,
+		},
+		UrgentPriorities: []string{"High"},
+		UrgentLimit:      10,
+		AtRiskFraction:   0.8,
+		AnomalyWindow:    7,
+		AnomalySigma:     3,
+		AnomalyMethod:    "stddev",
+	}
+}
+
+// Analyzer computes summaries under one set of Settings. It is safe for
+// concurrent use, and analyzers with different settings can run side by
+// side.
+type Analyzer struct {
+	location           *time.Location
+	weekStart          time.Weekday
+	granularity        string
+	asOfTime           time.Time
+	openRule           string
+	closedStatuses     []string
+	slaTargets         map[string]time.Duration
+	urgentPriorities   []string
+	urgentLimit        int
+	atRiskFraction     float64
+	capResolutionHours float64
+	maxIngestGap       time.Duration
+	baselineFrom       time.Time
+	baselineEnd        time.Time
+	baselineFromLabel  string
+	baselineToLabel    string
+	anomalyWindow      int
+	anomalySigma       float64
+	anomalyMethod      string
+	currentAlert       func() *Alert
+	computedFields     []string
+}
+
+// New returns an Analyzer using s
+func New(s Settings) *Analyzer {
+	a := &Analyzer{
+		location:           s.Location,
+		weekStart:          s.WeekStart,
+		granularity:        s.Granularity,
+		asOfTime:           s.AsOf,
+		openRule:           s.OpenRule,
+		closedStatuses:     s.ClosedStatuses,
+		slaTargets:         s.SLATargets,
+		urgentPriorities:   s.UrgentPriorities,
+		urgentLimit:        s.UrgentLimit,
+		atRiskFraction:     s.AtRiskFraction,
+		capResolutionHours: s.CapResolutionHours,
+		maxIngestGap:       s.MaxIngestGap,
+		baselineFrom:       s.BaselineStart,
+		baselineEnd:        s.BaselineEnd,
+		baselineFromLabel:  s.BaselineFrom,
+		baselineToLabel:    s.BaselineTo,
+		anomalyWindow:      s.AnomalyWindow,
+		anomalySigma:       s.AnomalySigma,
+		anomalyMethod:      s.AnomalyMethod,
+		currentAlert:       s.CurrentAlert,
+		computedFields:     s.ComputedFields,
+	}
+	if a.location == nil {
+		a.location = time.UTC
+	}
+	if a.currentAlert == nil {
+		a.currentAlert = func() *Alert { return nil }
+	}
+	return a
+}
+
+// IsClosed applies the open rule:
+//   - closedat: closed when closed_at is set (status is ignored)
+//   - status:   closed when status is in ClosedStatuses (closed_at is ignored)
+//   - both:     closed only when closed_at is set and the status is closed
+func (a *Analyzer) IsClosed(t Ticket) bool {
+	switch a.openRule {
+	case "status":
+		return inList(a.closedStatuses, t.Status)
+	case "both":
+		return t.ClosedAt != nil && inList(a.closedStatuses, t.Status)
+	}
+	return t.ClosedAt != nil
+}
+
+// ClosedTime returns when a ticket closed, if it counts as closed and has a
+// closed_at to say when
+func (a *Analyzer) ClosedTime(t Ticket) (time.Time, bool) {
+	if t.ClosedAt == nil || !a.IsClosed(t) {
+		return time.Time{}, false
+	}
+	return *t.ClosedAt, true
+}
+
+// StartOfWeek returns midnight on the first day of t's week, in the
+// configured time zone and honouring the week start
+func (a *Analyzer) StartOfWeek(t time.Time) time.Time {
+	t = t.In(a.location)
+	offset := (int(t.Weekday()) - int(a.weekStart) + 7) % 7
+	y, m, d := t.Date()
+	return time.Date(y, m, d-offset, 0, 0, 0, 0, a.location)
+}
+
+// periodStart truncates t to the start of its granularity period
+func (a *Analyzer) periodStart(t time.Time) time.Time {
+	t = t.In(a.location)
+	y, m, d := t.Date()
+	switch a.granularity {
+	case "day":
+		return time.Date(y, m, d, 0, 0, 0, 0, a.location)
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, a.location)
+	}
+	return a.StartOfWeek(t)
+}
+
+// previousPeriod returns the start of the period before the one starting at p
+func (a *Analyzer) previousPeriod(p time.Time) time.Time {
+	switch a.granularity {
+	case "day":
+		return p.AddDate(0, 0, -1)
+	case "month":
+		return p.AddDate(0, -1, 0)
+	}
+	return p.AddDate(0, 0, -7)
+}
+
+// ReferenceTime is "now" for age and trailing-window calculations
+func (a *Analyzer) ReferenceTime() time.Time {
+	if !a.asOfTime.IsZero() {
+		return a.asOfTime
+	}
+	return time.Now()
+}
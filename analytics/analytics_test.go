@@ -0,0 +1,54 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOpenRules(t *testing.T) {
+	closedAt := time.Date(2026, 1, 6, 9, 0, 0, 0, time.UTC)
+	tickets := map[string]Ticket{
+		"closed_at and closed status":    {ClosedAt: &closedAt, Status: "Resolved"},
+		"closed_at but open status":      {ClosedAt: &closedAt, Status: "In Progress"},
+		"closed status but no closed_at": {Status: "Done"},
+		"neither":                        {Status: "Open"},
+		"status differs in case":         {ClosedAt: &closedAt, Status: "closed"}, // statuses match ignoring case
+	}
+	tests := []struct {
+		rule   string
+		ticket string
+		closed bool
+		timed  bool // ClosedTime reports closedAt
+	}{
+		{"closedat", "closed_at and closed status", true, true},
+		{"closedat", "closed_at but open status", true, true},
+		{"closedat", "closed status but no closed_at", false, false},
+		{"closedat", "neither", false, false},
+		{"closedat", "status differs in case", true, true},
+
+		{"status", "closed_at and closed status", true, true},
+		{"status", "closed_at but open status", false, false},
+		{"status", "closed status but no closed_at", true, false},
+		{"status", "neither", false, false},
+		{"status", "status differs in case", true, true},
+
+		{"both", "closed_at and closed status", true, true},
+		{"both", "closed_at but open status", false, false},
+		{"both", "closed status but no closed_at", false, false},
+		{"both", "neither", false, false},
+		{"both", "status differs in case", true, true},
+	}
+	for _, tt := range tests {
+		s := DefaultSettings()
+		s.OpenRule = tt.rule
+		a := New(s)
+		ticket := tickets[tt.ticket]
+		if got := a.IsClosed(ticket); got != tt.closed {
+			t.Errorf("%s, %s: IsClosed = %v, want %v", tt.rule, tt.ticket, got, tt.closed)
+		}
+		got, ok := a.ClosedTime(ticket)
+		if ok != tt.timed || (ok && !got.Equal(closedAt)) {
+			t.Errorf("%s, %s: ClosedTime = %v, %v; want closed_at: %v", tt.rule, tt.ticket, got, ok, tt.timed)
+		}
+	}
+}
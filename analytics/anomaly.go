@@ -0,0 +1,143 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// DayAnomaly is a day whose ticket count deviates from its trailing window
+type DayAnomaly struct {
+	Date      string  `json:"date"`
+	Count     int     `json:"count"`
+	Expected  float64 `json:"expected"`
+	ZScore    float64 `json:"z_score"`
+	Direction string  `json:"direction"` // "high" or "low"
+}
+
+// DailyCounts returns created-ticket counts for every day between the first
+// and last ticket, including days with no tickets
+func DailyCounts(t []Ticket) []DayCount {
+	if len(t) == 0 {
+		return nil
+	}
+	byDay := make(map[string]int)
+	first, last := "", ""
+	for _, ticket := range t {
+		d := ticket.CreatedAt.Format(DateLayout)
+		byDay[d]++
+		if first == "" || d < first {
+			first = d
+		}
+		if d > last {
+			last = d
+		}
+	}
+
+	start, _ := time.Parse(DateLayout, first)
+	end, _ := time.Parse(DateLayout, last)
+	var days []DayCount
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		key := d.Format(DateLayout)
+		days = append(days, DayCount{Date: key, Count: byDay[key]})
+	}
+	return days
+}
+
+// AnomalyMethods are the -anomaly-method values
+var AnomalyMethods = []string{"stddev", "mad"}
+
+// madScale turns a median absolute deviation into a standard deviation
+// estimate for normally distributed counts, so -anomaly-sigma means the
+// same for both methods
+const madScale = 1.4826
+
+// FindAnomalies runs the named detector over days
+func FindAnomalies(days []DayCount, method string, window int, sigma float64) []DayAnomaly {
+	if method == "mad" {
+		return detectAnomaliesMAD(days, window, sigma)
+	}
+	return detectAnomalies(days, window, sigma)
+}
+
+// detectAnomalies flags days whose count is at least sigma standard
+// deviations from the mean of the preceding window days. Days whose window
+// has no variance are never flagged.
+func detectAnomalies(days []DayCount, window int, sigma float64) []DayAnomaly {
+	var out []DayAnomaly
+	for i := window; i < len(days); i++ {
+		var sum float64
+		for _, d := range days[i-window : i] {
+			sum += float64(d.Count)
+		}
+		mean := sum / float64(window)
+
+		var sq float64
+		for _, d := range days[i-window : i] {
+			sq += (float64(d.Count) - mean) * (float64(d.Count) - mean)
+		}
+		sd := math.Sqrt(sq / float64(window-1))
+		if sd == 0 {
+			continue
+		}
+
+		z := (float64(days[i].Count) - mean) / sd
+		if math.Abs(z) < sigma {
+			continue
+		}
+		dir := "high"
+		if z < 0 {
+			dir = "low"
+		}
+		out = append(out, DayAnomaly{
+			Date:      days[i].Date,
+			Count:     days[i].Count,
+			Expected:  mean,
+			ZScore:    z,
+			Direction: dir,
+		})
+	}
+	return out
+}
+
+// detectAnomaliesMAD is detectAnomalies with the median and the scaled
+// median absolute deviation of the window, so one spike doesn't inflate
+// the baseline and hide the days after it. Windows where most days have
+// the same count have no deviation and are never flagged.
+func detectAnomaliesMAD(days []DayCount, window int, sigma float64) []DayAnomaly {
+	var out []DayAnomaly
+	counts := make([]float64, window)
+	for i := window; i < len(days); i++ {
+		for j, d := range days[i-window : i] {
+			counts[j] = float64(d.Count)
+		}
+		sort.Float64s(counts)
+		med := percentile(counts, 50)
+		dev := make([]float64, window)
+		for j, c := range counts {
+			dev[j] = math.Abs(c - med)
+		}
+		sort.Float64s(dev)
+		sd := madScale * percentile(dev, 50)
+		if sd == 0 {
+			continue
+		}
+
+		z := (float64(days[i].Count) - med) / sd
+		if math.Abs(z) < sigma {
+			continue
+		}
+		dir := "high"
+		if z < 0 {
+			dir = "low"
+		}
+		out = append(out, DayAnomaly{
+			Date:      days[i].Date,
+			Count:     days[i].Count,
+			Expected:  med,
+			ZScore:    z,
+			Direction: dir,
+		})
+	}
+	return out
+}
@@ -0,0 +1,93 @@
+package analytics
+
+import (
+	"sort"
+)
+
+// CategoryDetail is one category as GET /api/categories/{name} describes it
+type CategoryDetail struct {
+	Category      string          `json:"category"`
+	Total         int             `json:"total"`
+	Open          int             `json:"open"`
+	Closed        int             `json:"closed"`
+	TicketsPerDay []DayCount      `json:"tickets_per_day"`
+	ByPriority    []PriorityStats `json:"by_priority"`
+	// Resolution is null until a ticket in the category has been resolved
+	Resolution *ResolutionPercentiles `json:"resolution_hours"`
+	SLA        SLAReport              `json:"sla"`
+	BacklogAge []AgeBucket            `json:"backlog_age"`
+	// OldestOpen lists open tickets, longest open first
+	OldestOpen []OpenTicket `json:"oldest_open"`
+}
+
+// ResolutionPercentiles summarises durations in hours: the resolution
+// hours of closed tickets, or first-response times
+type ResolutionPercentiles struct {
+	Count int     `json:"count"`
+	Avg   float64 `json:"avg"`
+	P50   float64 `json:"p50"`
+	P75   float64 `json:"p75"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+	Max   float64 `json:"max"`
+}
+
+// newPercentiles summarises hours, which it sorts; nil when empty
+func newPercentiles(hours []float64) *ResolutionPercentiles {
+	if len(hours) == 0 {
+		return nil
+	}
+	sort.Float64s(hours)
+	sum := 0.0
+	for _, h := range hours {
+		sum += h
+	}
+	return &ResolutionPercentiles{
+		Count: len(hours),
+		Avg:   sum / float64(len(hours)),
+		P50:   percentile(hours, 50),
+		P75:   percentile(hours, 75),
+		P90:   percentile(hours, 90),
+		P95:   percentile(hours, 95),
+		Max:   hours[len(hours)-1],
+	}
+}
+
+// categoryDetailFields are the summary metrics a category detail reuses
+var categoryDetailFields = map[string]bool{"tickets_per_day": true, "tickets_by_priority": true,
+	"sla": true, "backlog_age": true, "total_tickets": true, "open_tickets": true, "closed_tickets": true}
+
+// DescribeCategory describes the tickets in t, which all share one category
+func (a *Analyzer) DescribeCategory(name string, t []Ticket, limit int) CategoryDetail {
+	s := a.Compute(t, Options{Fields: categoryDetailFields})
+	d := CategoryDetail{
+		Category:      name,
+		Total:         s.TotalTickets,
+		Open:          s.OpenTickets,
+		Closed:        s.ClosedTickets,
+		TicketsPerDay: s.TicketsPerDay,
+		ByPriority:    s.TicketsByPriority,
+		SLA:           s.SLA,
+		BacklogAge:    s.BacklogAge,
+		OldestOpen:    []OpenTicket{},
+	}
+	if d.TicketsPerDay == nil {
+		d.TicketsPerDay = []DayCount{}
+	}
+
+	var hours []float64
+	now := a.ReferenceTime()
+	for _, ticket := range t {
+		if h, ok := a.ResolutionHours(ticket); ok {
+			hours = append(hours, h)
+		} else if !a.IsClosed(ticket) {
+			d.OldestOpen = append(d.OldestOpen, a.NewOpenTicket(ticket, now))
+		}
+	}
+	d.Resolution = newPercentiles(hours)
+	sort.SliceStable(d.OldestOpen, func(i, j int) bool { return d.OldestOpen[i].AgeHours > d.OldestOpen[j].AgeHours })
+	if len(d.OldestOpen) > limit {
+		d.OldestOpen = d.OldestOpen[:limit]
+	}
+	return d
+}
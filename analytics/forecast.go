@@ -0,0 +1,116 @@
+package analytics
+
+import (
+	"math"
+	"time"
+)
+
+// forecastHistoryDays is how many complete days before the reference day
+// the daily forecast is fitted to
+const forecastHistoryDays = 28
+
+// DayForecast is one projected day with its 95% band
+type DayForecast struct {
+	Date     string  `json:"date"`
+	Expected float64 `json:"expected"`
+	Low      float64 `json:"low"`
+	High     float64 `json:"high"`
+}
+
+// Forecast is the response of /api/forecast
+type Forecast struct {
+	Method      string        `json:"method"`
+	HistoryDays int           `json:"history_days"`
+	Level       float64       `json:"level"` // mean tickets per day over the history
+	Seasonal    bool          `json:"seasonal"`
+	Days        []DayForecast `json:"days"`
+	Total       DayForecast   `json:"total"` // Date is empty; sums over Days
+}
+
+// ForecastDaily projects ticket volume for the days starting at the
+// reference day. It fits a moving average with weekly seasonality to the
+// complete days before it: the level is the mean daily count, and once
+// there are two full weeks each weekday is scaled by its share of that
+// mean. The band is 1.96 standard deviations of the fit's residuals.
+func (a *Analyzer) ForecastDaily(t []Ticket, now time.Time, days int) Forecast {
+	today := now.In(a.location).Format(DateLayout)
+	end, _ := time.Parse(DateLayout, today)
+	start := end.AddDate(0, 0, -forecastHistoryDays)
+
+	// DailyCounts stops at the newest ticket; quiet days up to yesterday
+	// are part of the history too
+	byDay := make(map[string]int)
+	earliest := ""
+	for _, d := range DailyCounts(t) {
+		byDay[d.Date] = d.Count
+		if earliest == "" {
+			earliest = d.Date
+		}
+	}
+	f := Forecast{Method: "moving average", Days: []DayForecast{}}
+	if earliest == "" || earliest >= today {
+		f.Method = "no data"
+		return f
+	}
+	if first, _ := time.Parse(DateLayout, earliest); first.After(start) {
+		start = first
+	}
+	var history []DayCount
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		key := d.Format(DateLayout)
+		history = append(history, DayCount{Date: key, Count: byDay[key]})
+	}
+	f.HistoryDays = len(history)
+
+	var sum float64
+	for _, d := range history {
+		sum += float64(d.Count)
+	}
+	f.Level = sum / float64(len(history))
+
+	// Weekday factors need every weekday seen at least twice
+	factor := [7]float64{1, 1, 1, 1, 1, 1, 1}
+	if len(history) >= 14 && f.Level > 0 {
+		var total [7]float64
+		var n [7]int
+		for _, d := range history {
+			day, _ := time.Parse(DateLayout, d.Date)
+			total[day.Weekday()] += float64(d.Count)
+			n[day.Weekday()]++
+		}
+		for w := range factor {
+			factor[w] = total[w] / float64(n[w]) / f.Level
+		}
+		f.Seasonal = true
+		f.Method = "moving average with weekly seasonality"
+	}
+
+	var sq float64
+	for _, d := range history {
+		day, _ := time.Parse(DateLayout, d.Date)
+		r := float64(d.Count) - f.Level*factor[day.Weekday()]
+		sq += r * r
+	}
+	var sd float64
+	if len(history) > 1 {
+		sd = math.Sqrt(sq / float64(len(history)-1))
+	}
+
+	for i := 0; i < days; i++ {
+		day := end.AddDate(0, 0, i)
+		expected := f.Level * factor[day.Weekday()]
+		f.Days = append(f.Days, DayForecast{
+			Date:     day.Format(DateLayout),
+			Expected: expected,
+			Low:      math.Max(0, expected-1.96*sd),
+			High:     expected + 1.96*sd,
+		})
+		f.Total.Expected += expected
+	}
+	// Residuals are treated as independent, so the total's spread grows
+	// with the square root of the horizon
+	spread := 1.96 * sd * math.Sqrt(float64(days))
+	f.Total.Low = math.Max(0, f.Total.Expected-spread)
+	f.Total.High = f.Total.Expected + spread
+	return f
+}
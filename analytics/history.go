@@ -0,0 +1,102 @@
+package analytics
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// StatusChange is one row of the -status-history file: the ticket entered
+// Status at At
+type StatusChange struct {
+	Status string
+	At     time.Time
+}
+
+// StatusTime is how long tickets spent in one status
+type StatusTime struct {
+	Status      string  `json:"status"`
+	Tickets     int     `json:"tickets"` // tickets that were ever in it
+	TotalHours  float64 `json:"total_hours"`
+	AvgHours    float64 `json:"avg_hours"` // per ticket that was in it
+	MedianHours float64 `json:"median_hours"`
+	Share       float64 `json:"share"` // of all tracked time
+
+	hours map[int]float64
+}
+
+// statusIntervals calls fn for each stretch of time a ticket spent in a
+// status. The last status lasts until the ticket closed, or until now
+// while it is open.
+func (a *Analyzer) statusIntervals(t Ticket, now time.Time, fn func(status string, hours float64)) {
+	for i, c := range t.History {
+		end := now
+		switch {
+		case i+1 < len(t.History):
+			end = t.History[i+1].At
+		case t.ClosedAt != nil && a.IsClosed(t):
+			end = *t.ClosedAt
+		}
+		if end.After(c.At) {
+			fn(c.Status, end.Sub(c.At).Hours())
+		}
+	}
+}
+
+// historyReopens counts the changes from a -closed-statuses status to one
+// that isn't
+func (a *Analyzer) historyReopens(h []StatusChange) int {
+	n := 0
+	for i := 1; i < len(h); i++ {
+		if inList(a.closedStatuses, h[i-1].Status) && !inList(a.closedStatuses, h[i].Status) {
+			n++
+		}
+	}
+	return n
+}
+
+// computeTimeInStatus totals the hours tickets spent in each status, most
+// time first. Statuses are grouped case-insensitively under the first
+// spelling seen.
+func (a *Analyzer) computeTimeInStatus(t []Ticket, s *Summary) {
+	now := a.ReferenceTime()
+	index := make(map[string]*StatusTime)
+	var out []StatusTime
+	var order []*StatusTime
+	var total float64
+	for _, ticket := range t {
+		a.statusIntervals(ticket, now, func(status string, hours float64) {
+			key := strings.ToLower(status)
+			st := index[key]
+			if st == nil {
+				st = &StatusTime{Status: status, hours: make(map[int]float64)}
+				index[key] = st
+				order = append(order, st)
+			}
+			st.hours[ticket.ID] += hours
+			st.TotalHours += hours
+			total += hours
+		})
+	}
+	for _, st := range order {
+		per := make([]float64, 0, len(st.hours))
+		for _, h := range st.hours {
+			per = append(per, h)
+		}
+		sort.Float64s(per)
+		st.Tickets = len(per)
+		st.AvgHours = st.TotalHours / float64(len(per))
+		st.MedianHours = percentile(per, 50)
+		if total > 0 {
+			st.Share = st.TotalHours / total
+		}
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].TotalHours != out[j].TotalHours {
+			return out[i].TotalHours > out[j].TotalHours
+		}
+		return out[i].Status < out[j].Status
+	})
+	s.TimeInStatus = out
+}
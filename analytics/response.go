@@ -0,0 +1,68 @@
+package analytics
+
+import (
+	"sort"
+)
+
+// FirstResponseReport summarises how long tickets waited for their first
+// response, from the optional first_response_at column. Without the column
+// it is empty.
+type FirstResponseReport struct {
+	// Awaiting counts open tickets not yet responded to
+	Awaiting int `json:"awaiting"`
+	// Hours is null until a ticket has a first response
+	Hours      *ResolutionPercentiles  `json:"hours"`
+	ByPriority []PriorityFirstResponse `json:"by_priority"`
+}
+
+// PriorityFirstResponse is one priority's first-response times
+type PriorityFirstResponse struct {
+	Priority string                 `json:"priority"`
+	Awaiting int                    `json:"awaiting"`
+	Hours    *ResolutionPercentiles `json:"hours"`
+}
+
+// FirstResponseHours returns how long a ticket waited for its first
+// response; ok is false when it has none
+func FirstResponseHours(t Ticket) (hours float64, ok bool) {
+	if t.FirstResponseAt == nil {
+		return 0, false
+	}
+	return t.FirstResponseAt.Sub(t.CreatedAt).Hours(), true
+}
+
+// computeFirstResponse reports first-response times overall and per
+// priority. Open tickets without a response only count as awaiting once
+// some ticket has the column, so data without it reports nothing.
+func (a *Analyzer) computeFirstResponse(t []Ticket, s *Summary) {
+	report := FirstResponseReport{ByPriority: []PriorityFirstResponse{}}
+	var all []float64
+	hours := make(map[string][]float64)
+	awaiting := make(map[string]int)
+	for _, ticket := range t {
+		if h, ok := FirstResponseHours(ticket); ok {
+			all = append(all, h)
+			hours[ticket.Priority] = append(hours[ticket.Priority], h)
+		} else if !a.IsClosed(ticket) {
+			awaiting[ticket.Priority]++
+		}
+	}
+	if len(all) == 0 {
+		s.FirstResponse = report
+		return
+	}
+	report.Hours = newPercentiles(all)
+	for p, n := range awaiting {
+		report.Awaiting += n
+		if _, ok := hours[p]; !ok {
+			hours[p] = nil
+		}
+	}
+	for p, h := range hours {
+		report.ByPriority = append(report.ByPriority, PriorityFirstResponse{Priority: p, Awaiting: awaiting[p], Hours: newPercentiles(h)})
+	}
+	sort.Slice(report.ByPriority, func(i, j int) bool {
+		return PriorityLess(report.ByPriority[i].Priority, report.ByPriority[j].Priority)
+	})
+	s.FirstResponse = report
+}
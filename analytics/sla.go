@@ -0,0 +1,170 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ParseSLA parses "High=24h,Medium=72h" into per-priority targets
+func ParseSLA(spec string) (map[string]time.Duration, error) {
+	targets := make(map[string]time.Duration)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		eq := strings.Index(part, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid SLA entry %q, want Priority=duration", part)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(part[eq+1:]))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid SLA duration in %q", part)
+		}
+		targets[strings.ToLower(strings.TrimSpace(part[:eq]))] = d
+	}
+	return targets, nil
+}
+
+// ParseSLAFile reads targets from a JSON object of priority to duration,
+// e.g. {"P1": "4h", "P2": "24h"}
+func ParseSLAFile(path string) (map[string]time.Duration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: want a JSON object of priority to duration: %v", path, err)
+	}
+	targets := make(map[string]time.Duration, len(raw))
+	for p, v := range raw {
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%s: invalid SLA duration %q for %s", path, v, p)
+		}
+		targets[strings.ToLower(strings.TrimSpace(p))] = d
+	}
+	return targets, nil
+}
+
+// slaFor returns the resolution target for a priority, if one is configured
+func (a *Analyzer) slaFor(priority string) (time.Duration, bool) {
+	d, ok := a.slaTargets[strings.ToLower(priority)]
+	return d, ok
+}
+
+// OpenTicket is an open ticket annotated with its age against the reference clock
+type OpenTicket struct {
+	Ticket
+	AgeHours    float64 `json:"age_hours"`
+	SLAHours    float64 `json:"sla_hours,omitempty"`
+	SLAUsed     float64 `json:"sla_used,omitempty"` // fraction of the SLA elapsed
+	SLABreached bool    `json:"sla_breached"`
+}
+
+func (a *Analyzer) NewOpenTicket(t Ticket, now time.Time) OpenTicket {
+	ot := OpenTicket{Ticket: t, AgeHours: now.Sub(t.CreatedAt).Hours()}
+	if d, ok := a.slaFor(t.Priority); ok {
+		ot.SLAHours = d.Hours()
+		ot.SLAUsed = ot.AgeHours / ot.SLAHours
+		ot.SLABreached = ot.AgeHours > ot.SLAHours
+	}
+	return ot
+}
+
+// SLABreach is a ticket that missed its target: closed late, or still open
+// past it
+type SLABreach struct {
+	Ticket
+	TargetHours  float64 `json:"target_hours"`
+	ElapsedHours float64 `json:"elapsed_hours"`
+	Open         bool    `json:"open"`
+}
+
+// SLAReport summarises breaches across tickets whose priority has a target
+type SLAReport struct {
+	Tracked    int               `json:"tracked"`
+	Breached   int               `json:"breached"`
+	BreachPct  float64           `json:"breach_pct"`
+	ByPriority []SLAPriorityStat `json:"by_priority"`
+}
+
+type SLAPriorityStat struct {
+	Priority    string  `json:"priority"`
+	TargetHours float64 `json:"target_hours"`
+	Tracked     int     `json:"tracked"`
+	Breached    int     `json:"breached"`
+	BreachPct   float64 `json:"breach_pct"`
+}
+
+// SLABreaches checks every ticket with a target against now, returning
+// how many were tracked and the breaches, worst overrun first
+func (a *Analyzer) SLABreaches(t []Ticket, now time.Time) (tracked int, breaches []SLABreach) {
+	for _, ticket := range t {
+		target, ok := a.slaFor(ticket.Priority)
+		if !ok {
+			continue
+		}
+		var elapsed time.Duration
+		open := !a.IsClosed(ticket)
+		if closedAt, ok := a.ClosedTime(ticket); ok {
+			elapsed = closedAt.Sub(ticket.CreatedAt)
+		} else if open {
+			elapsed = now.Sub(ticket.CreatedAt)
+		} else {
+			continue // closed by status with no closed_at: nothing to measure
+		}
+		tracked++
+		if elapsed > target {
+			breaches = append(breaches, SLABreach{
+				Ticket:       ticket,
+				TargetHours:  target.Hours(),
+				ElapsedHours: elapsed.Hours(),
+				Open:         open,
+			})
+		}
+	}
+	sort.Slice(breaches, func(i, j int) bool {
+		return breaches[i].ElapsedHours-breaches[i].TargetHours > breaches[j].ElapsedHours-breaches[j].TargetHours
+	})
+	return tracked, breaches
+}
+
+func (a *Analyzer) computeSLAReport(t []Ticket, s *Summary) {
+	now := a.ReferenceTime()
+	tracked, breaches := a.SLABreaches(t, now)
+	report := SLAReport{Tracked: tracked, Breached: len(breaches), ByPriority: []SLAPriorityStat{}}
+	if tracked > 0 {
+		report.BreachPct = 100 * float64(len(breaches)) / float64(tracked)
+	}
+
+	groups := make(map[string]*SLAPriorityStat)
+	for _, ticket := range t {
+		target, ok := a.slaFor(ticket.Priority)
+		if !ok || (a.IsClosed(ticket) && ticket.ClosedAt == nil) {
+			continue
+		}
+		g := groups[ticket.Priority]
+		if g == nil {
+			g = &SLAPriorityStat{Priority: ticket.Priority, TargetHours: target.Hours()}
+			groups[ticket.Priority] = g
+		}
+		g.Tracked++
+	}
+	for _, b := range breaches {
+		groups[b.Priority].Breached++
+	}
+	for _, g := range groups {
+		g.BreachPct = 100 * float64(g.Breached) / float64(g.Tracked)
+		report.ByPriority = append(report.ByPriority, *g)
+	}
+	sort.Slice(report.ByPriority, func(i, j int) bool {
+		return PriorityLess(report.ByPriority[i].Priority, report.ByPriority[j].Priority)
+	})
+	s.SLA = report
+}
@@ -0,0 +1,1900 @@
+package analytics
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// forecastWeeks is how many trailing 7-day windows feed the forecast
+const forecastWeeks = 4
+
+// Summary holds all computed dashboard statistics
+type Summary struct {
+	TicketsPerDay           []DayCount         `json:"tickets_per_day"`
+	TotalDays               int                `json:"total_days"`                        // len(TicketsPerDay) before days_limit/days_offset
+	TicketsPerDayRolling    []DayRolling       `json:"tickets_per_day_rolling,omitempty"` // only with ?window=N; see RollingDays
+	RollingWindow           int                `json:"rolling_window,omitempty"`          // N
+	TopCategories           []CategoryCount    `json:"top_categories"`
+	DominantCategoryPerDay  []DayCategory      `json:"dominant_category_per_day"`
+	AvgResolutionHoursByCat []CategoryAvgHours `json:"avg_resolution_hours_by_category"`
+
+	TicketsByPriority []PriorityStats `json:"tickets_by_priority"`
+
+	// Per assignee, busiest open load first; empty without an assignee
+	// column. UnassignedTickets counts tickets with no assignee.
+	TicketsByAgent    []AgentStats `json:"tickets_by_agent"`
+	UnassignedTickets int          `json:"unassigned_tickets"`
+
+	// Per tag, most tickets first; a ticket counts once under each of its
+	// tags. Empty without a tags column.
+	TicketsByTag    []TagStats `json:"tickets_by_tag"`
+	UntaggedTickets int        `json:"untagged_tickets"`
+
+	// Every observed category/priority combination with its ticket count
+	CategoryPriorityMatrix []CategoryPriorityCount `json:"category_priority_matrix"`
+
+	// 100/(1+CV) of resolution hours per category; higher is more predictable
+	ConsistencyScoreByCategory []CategoryScore `json:"consistency_score_by_category"`
+	// Five-number summary of uncapped resolution hours per category
+	ResolutionBoxplotByCategory []CategoryBoxplot `json:"resolution_boxplot_by_category"`
+	// Categories missing from AvgResolutionHoursByCat because none are closed
+	CategoriesWithoutResolutionData []string         `json:"categories_without_resolution_data"`
+	OpenVsClosed                    OpenClosedCounts `json:"open_vs_closed"`
+	TotalTickets                    int              `json:"total_tickets"`
+	OpenTickets                     int              `json:"open_tickets"`
+	ClosedTickets                   int              `json:"closed_tickets"`
+
+	// Distinct creation days vs the first-to-last span; a low ratio means gaps
+	DaysWithActivity int `json:"days_with_activity"`
+	DateRangeDays    int `json:"date_range_days"`
+
+	// Closures per day over the trailing 7 days and direction vs the 7 before
+	CurrentVelocity float64 `json:"current_velocity"`
+	VelocityTrend   string  `json:"velocity_trend"`
+
+	// Next-week volume estimate; see forecastNextWeek
+	ForecastNextWeek int    `json:"forecast_next_week"`
+	ForecastLow      int    `json:"forecast_next_week_low"`
+	ForecastHigh     int    `json:"forecast_next_week_high"`
+	ForecastMethod   string `json:"forecast_method"`
+
+	AvgResolutionByReassignmentCount []ReassignStat `json:"avg_resolution_by_reassignment_count"`
+
+	// Reopen counts come from -status-history when a ticket has one, else
+	// the reopened_count column; see ReopenCount
+	ReopenRateByPriority []PriorityRate `json:"reopen_rate_by_priority"`
+	ReopenRateByCategory []CategoryRate `json:"reopen_rate_by_category"`
+
+	// Mean reopens over closed tickets reopened at least once
+	AvgReopensBeforeClose      float64              `json:"avg_reopens_before_close"`
+	AvgReopensBeforeCloseByCat []CategoryAvgReopens `json:"avg_reopens_before_close_by_category"`
+
+	AnomalousDays []DayAnomaly `json:"anomalous_days"`
+
+	// Hours spent in each status, from -status-history; empty without it
+	TimeInStatus []StatusTime `json:"time_in_status"`
+
+	// Breach counts against -sla / -sla-file targets, closed and open
+	SLA SLAReport `json:"sla"`
+
+	// Per closure day, the share of SLA-tracked closures in the trailing
+	// slaTrendDays that met their -sla target
+	SLAComplianceTrend []DatePct `json:"sla_compliance_trend"`
+
+	// How long tickets waited for a first response, from the optional
+	// first_response_at column
+	FirstResponse FirstResponseReport `json:"first_response"`
+
+	UrgentOpenTickets []OpenTicket `json:"urgent_open_tickets"`
+	AtRiskTickets     []OpenTicket `json:"at_risk_tickets"`
+
+	// Age of each category's oldest open ticket; categories with none are omitted
+	LongestOpenByCategory []CategoryDuration `json:"longest_open_by_category"`
+	// Open tickets by how long they have been open, always in bucket order
+	BacklogAge []AgeBucket `json:"backlog_age"`
+	// Tickets whose closed_at and status disagree (see -closed-statuses)
+	InconsistentTickets []Ticket `json:"inconsistent_tickets"`
+
+	WeekendWeekdayResolution       WeekendWeekdayResolution `json:"weekend_weekday_resolution"`
+	AvgResolutionByCreationWeekday []WeekdayAvgHours        `json:"avg_resolution_by_creation_weekday"`
+	// When tickets arrive, by local weekday and hour of day
+	ArrivalHeatmap ArrivalHeatmap `json:"arrival_heatmap"`
+
+	// Closed tickets resolved in the week they were opened (see -week-start)
+	SameWeekClosures   int     `json:"same_week_closures"`
+	SameWeekClosurePct float64 `json:"same_week_closure_pct"`
+
+	CategoryChurn CategoryChurn `json:"category_churn"`
+
+	// The -granularity period containing the reference time against the
+	// period before it, for "up 12% vs last week" indicators
+	PeriodDeltas PeriodDeltas `json:"period_deltas"`
+
+	// Freshness: hours from the newest created_at to the reference time;
+	// IngestStalled is set when that exceeds -max-ingest-gap
+	HoursSinceLastTicket float64 `json:"hours_since_last_ticket"`
+	IngestStalled        bool    `json:"ingest_stalled"`
+
+	// Average resolution after -baseline-to compared with the baseline
+	// window; null unless both baseline flags are set
+	ResolutionVsBaseline *BaselineComparison `json:"resolution_vs_baseline"`
+
+	// Spearman rank correlation between priority level and resolution hours;
+	// negative means higher priority resolves faster
+	PriorityResolutionCorrelation float64 `json:"priority_resolution_correlation"`
+
+	// CategoryTree is only filled with ?hierarchical=1
+	CategoryTree []*CategoryNode `json:"category_tree,omitempty"`
+
+	// Alert is set while a configured threshold is exceeded
+	Alert *Alert `json:"alert"`
+
+	// Partial is set when some metrics failed; their fields keep zero values
+	Partial       bool     `json:"partial"`
+	FailedMetrics []string `json:"failed_metrics,omitempty"`
+}
+
+type DayCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// DayRolling is one day of tickets_per_day_rolling. RollingAvg is null
+// for the first window-1 days, before a full window of data.
+type DayRolling struct {
+	Date       string   `json:"date"`
+	Count      int      `json:"count"`
+	RollingAvg *float64 `json:"rolling_avg"`
+}
+
+type CategoryCount struct {
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
+
+// DayCategory is the category with the most tickets created on a day
+type DayCategory struct {
+	Date     string `json:"date"`
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
+
+type AgentStats struct {
+	Assignee string   `json:"assignee"`
+	Total    int      `json:"total"`
+	Open     int      `json:"open"`
+	Closed   int      `json:"closed"`
+	AvgHours *float64 `json:"avg_resolution_hours"`
+
+	totalHours float64
+	resolved   int
+}
+
+type TagStats struct {
+	Tag      string   `json:"tag"`
+	Total    int      `json:"total"`
+	Open     int      `json:"open"`
+	Closed   int      `json:"closed"`
+	AvgHours *float64 `json:"avg_resolution_hours"`
+
+	totalHours float64
+	resolved   int
+}
+
+type PriorityStats struct {
+	Priority string   `json:"priority"`
+	Total    int      `json:"total"`
+	Open     int      `json:"open"`
+	Closed   int      `json:"closed"`
+	AvgHours *float64 `json:"avg_resolution_hours"` // null until one is resolved
+
+	totalHours float64
+	resolved   int // closed tickets with a resolution time
+}
+
+type CategoryPriorityCount struct {
+	Category string `json:"category"`
+	Priority string `json:"priority"`
+	Count    int    `json:"count"`
+}
+
+type CategoryAvgHours struct {
+	Category    string  `json:"category"`
+	AvgHours    float64 `json:"avg_hours"`     // capped by -cap-resolution-hours
+	RawAvgHours float64 `json:"raw_avg_hours"` // uncapped
+	// Percentiles of uncapped hours, so the long tail stays visible
+	MedianHours float64 `json:"median_hours"`
+	P90Hours    float64 `json:"p90_hours"`
+	P99Hours    float64 `json:"p99_hours"`
+}
+
+type DatePct struct {
+	Date     string   `json:"date"`
+	Closures int      `json:"closures"` // SLA-tracked closures in the window
+	Pct      *float64 `json:"pct"`      // null when Closures is 0
+}
+
+type CategoryDuration struct {
+	Category string  `json:"category"`
+	TicketID int     `json:"ticket_id"`
+	AgeHours float64 `json:"age_hours"`
+}
+
+// CategoryChurn compares the categories seen in the latest -granularity
+// period with data against the period before it
+type CategoryChurn struct {
+	Granularity           string   `json:"granularity"`
+	Period                string   `json:"period"`
+	PriorPeriod           string   `json:"prior_period"`
+	New                   int      `json:"new"`
+	Disappeared           int      `json:"disappeared"`
+	Persisted             int      `json:"persisted"`
+	NewCategories         []string `json:"new_categories"`
+	DisappearedCategories []string `json:"disappeared_categories"`
+}
+
+// PeriodDeltas compares volume, backlog and resolution time between two
+// consecutive -granularity periods. Backlog is the open count at the end of
+// each period, which for the current one is the reference time.
+type PeriodDeltas struct {
+	Granularity        string `json:"granularity"`
+	Period             string `json:"period"`
+	PriorPeriod        string `json:"prior_period"`
+	Volume             Delta  `json:"volume"`
+	Backlog            Delta  `json:"backlog"`
+	AvgResolutionHours Delta  `json:"avg_resolution_hours"`
+}
+
+// Delta is one metric in two periods; PctChange is null when Previous is 0
+type Delta struct {
+	Current   float64  `json:"current"`
+	Previous  float64  `json:"previous"`
+	Change    float64  `json:"change"`
+	PctChange *float64 `json:"pct_change"`
+}
+
+func NewDelta(cur, prev float64) Delta {
+	d := Delta{Current: cur, Previous: prev, Change: cur - prev}
+	if prev != 0 {
+		pct := 100 * (cur - prev) / prev
+		d.PctChange = &pct
+	}
+	return d
+}
+
+type CategoryScore struct {
+	Category    string  `json:"category"`
+	Closed      int     `json:"closed"`
+	MeanHours   float64 `json:"mean_hours"`
+	StdDevHours float64 `json:"stddev_hours"`
+	Score       float64 `json:"score"`
+}
+
+type CategoryBoxplot struct {
+	Category string  `json:"category"`
+	Count    int     `json:"count"`
+	Min      float64 `json:"min"`
+	Q1       float64 `json:"q1"`
+	Median   float64 `json:"median"`
+	Q3       float64 `json:"q3"`
+	Max      float64 `json:"max"`
+	// IDs of tickets more than 1.5×IQR outside the quartiles
+	Outliers []int `json:"outlier_ids"`
+}
+
+type BaselineComparison struct {
+	BaselineFrom     string  `json:"baseline_from"`
+	BaselineTo       string  `json:"baseline_to"`
+	BaselineClosed   int     `json:"baseline_closed"`
+	BaselineAvgHours float64 `json:"baseline_avg_hours"`
+	CurrentClosed    int     `json:"current_closed"`
+	CurrentAvgHours  float64 `json:"current_avg_hours"`
+	// Negative means faster than the baseline; null when either side has
+	// no closed tickets
+	PctChange *float64 `json:"pct_change"`
+}
+
+// AgeBucket counts open tickets aged at least MinDays and under MaxDays;
+// MaxDays is null for the last, open-ended bucket
+type AgeBucket struct {
+	Label   string `json:"label"`
+	MinDays int    `json:"min_days"`
+	MaxDays *int   `json:"max_days"`
+	Count   int    `json:"count"`
+}
+
+type ReassignStat struct {
+	Reassignments int     `json:"reassignments"`
+	Tickets       int     `json:"tickets"`
+	AvgHours      float64 `json:"avg_hours"`
+}
+
+// ResolutionGroup summarises resolution time for a subset of tickets
+type ResolutionGroup struct {
+	Tickets  int     `json:"tickets"`
+	Closed   int     `json:"closed"`
+	AvgHours float64 `json:"avg_hours"`
+}
+
+type WeekendWeekdayResolution struct {
+	Weekend ResolutionGroup `json:"weekend"`
+	Weekday ResolutionGroup `json:"weekday"`
+}
+
+// PriorityRate is the share of a priority's closed tickets that were reopened
+type PriorityRate struct {
+	Priority string  `json:"priority"`
+	Closed   int     `json:"closed"`
+	Reopened int     `json:"reopened"`
+	Rate     float64 `json:"rate"`
+}
+
+// CategoryRate is the share of a category's closed tickets that were reopened
+type CategoryRate struct {
+	Category string  `json:"category"`
+	Closed   int     `json:"closed"`
+	Reopened int     `json:"reopened"`
+	Rate     float64 `json:"rate"`
+}
+
+type CategoryAvgReopens struct {
+	Category   string  `json:"category"`
+	Tickets    int     `json:"tickets"`
+	AvgReopens float64 `json:"avg_reopens"`
+
+	total int // sum of reopens, for AvgReopens
+}
+
+type WeekdayAvgHours struct {
+	Weekday  string  `json:"weekday"`
+	Closed   int     `json:"closed"`
+	AvgHours float64 `json:"avg_hours"`
+}
+
+// ArrivalHeatmap counts tickets created per weekday, in -week-start order,
+// and per hour. The hour counts are only filled when some created_at has a
+// time of day; with bare dates every ticket would land at midnight.
+type ArrivalHeatmap struct {
+	HasTimes    bool              `json:"has_times"`
+	ByWeekday   []WeekdayArrivals `json:"by_weekday"`
+	ByHour      []int             `json:"by_hour,omitempty"` // 24 entries, hour 0 first
+	PeakWeekday string            `json:"peak_weekday"`
+	PeakHour    *int              `json:"peak_hour"`
+}
+
+type WeekdayArrivals struct {
+	Weekday string `json:"weekday"`
+	Count   int    `json:"count"`
+	Hours   []int  `json:"hours,omitempty"` // 24 entries, as ByHour
+}
+
+// CategoryNode is one level of a "Parent/Child" category hierarchy. Counts
+// and averages roll up everything beneath the node.
+type CategoryNode struct {
+	Name     string          `json:"name"`
+	Path     string          `json:"path"`
+	Count    int             `json:"count"`
+	Open     int             `json:"open"`
+	AvgHours float64         `json:"avg_hours"`
+	Children []*CategoryNode `json:"children,omitempty"`
+
+	closed     int
+	totalHours float64
+}
+
+type OpenClosedCounts struct {
+	Open   int `json:"open"`
+	Closed int `json:"closed"`
+}
+
+// metric computes one part of the Summary. fields lists the JSON keys it
+// fills so callers can request a subset via ?fields=. Metrics with an optIn
+// func only run when it returns true or their field is explicitly requested.
+type metric struct {
+	fields  []string
+	compute func(a *Analyzer, t []Ticket, s *Summary)
+	optIn   func(o Options) bool
+}
+
+// Options controls which metrics Compute runs
+type Options struct {
+	// Fields restricts the summary to these JSON keys; nil means all
+	Fields map[string]bool
+	// Hierarchical adds CategoryTree, splitting categories on "/"
+	Hierarchical bool
+}
+
+// wants reports whether opts selects metric m
+func (o Options) wants(m metric) bool {
+	requested := o.Fields != nil && wantsAny(o.Fields, m.fields)
+	if m.optIn != nil {
+		return requested || m.optIn(o)
+	}
+	return o.Fields == nil || requested
+}
+
+var metrics = []metric{
+	{[]string{"tickets_per_day", "total_days"}, (*Analyzer).computeTicketsPerDay, nil},
+	{[]string{"top_categories"}, (*Analyzer).computeTopCategories, nil},
+	{[]string{"dominant_category_per_day"}, (*Analyzer).computeDominantCategoryPerDay, nil},
+	{[]string{"tickets_by_priority"}, (*Analyzer).computeTicketsByPriority, nil},
+	{[]string{"tickets_by_agent", "unassigned_tickets"}, (*Analyzer).computeTicketsByAgent, nil},
+	{[]string{"tickets_by_tag", "untagged_tickets"}, (*Analyzer).computeTicketsByTag, nil},
+	{[]string{"category_priority_matrix"}, (*Analyzer).computeCategoryPriorityMatrix, nil},
+	{[]string{"avg_resolution_hours_by_category"}, (*Analyzer).computeAvgResolutionByCat, nil},
+	{[]string{"consistency_score_by_category"}, (*Analyzer).computeConsistencyScores, nil},
+	{[]string{"resolution_boxplot_by_category"}, (*Analyzer).computeResolutionBoxplots, nil},
+	{[]string{"categories_without_resolution_data"}, (*Analyzer).computeCategoriesWithoutResolution, nil},
+	{[]string{"open_vs_closed"}, (*Analyzer).computeOpenVsClosed, nil},
+	{[]string{"total_tickets"}, (*Analyzer).computeTotalTickets, nil},
+	{[]string{"open_tickets"}, (*Analyzer).computeOpenTickets, nil},
+	{[]string{"closed_tickets"}, (*Analyzer).computeClosedTickets, nil},
+	{[]string{"days_with_activity", "date_range_days"}, (*Analyzer).computeActivityDays, nil},
+	{[]string{"current_velocity", "velocity_trend"}, (*Analyzer).computeVelocity, nil},
+	{[]string{"forecast_next_week", "forecast_next_week_low", "forecast_next_week_high", "forecast_method"}, (*Analyzer).computeForecast, nil},
+	{[]string{"avg_resolution_by_reassignment_count"}, (*Analyzer).computeAvgResolutionByReassignments, nil},
+	{[]string{"reopen_rate_by_priority"}, (*Analyzer).computeReopenRateByPriority, nil},
+	{[]string{"reopen_rate_by_category"}, (*Analyzer).computeReopenRateByCategory, nil},
+	{[]string{"avg_reopens_before_close", "avg_reopens_before_close_by_category"}, (*Analyzer).computeAvgReopensBeforeClose, nil},
+	{[]string{"anomalous_days"}, (*Analyzer).computeAnomalousDays, nil},
+	{[]string{"time_in_status"}, (*Analyzer).computeTimeInStatus, nil},
+	{[]string{"sla"}, (*Analyzer).computeSLAReport, nil},
+	{[]string{"sla_compliance_trend"}, (*Analyzer).computeSLAComplianceTrend, nil},
+	{[]string{"first_response"}, (*Analyzer).computeFirstResponse, nil},
+	{[]string{"urgent_open_tickets"}, (*Analyzer).computeUrgentOpenTickets, nil},
+	{[]string{"at_risk_tickets"}, (*Analyzer).computeAtRiskTickets, nil},
+	{[]string{"longest_open_by_category"}, (*Analyzer).computeLongestOpenByCategory, nil},
+	{[]string{"backlog_age"}, (*Analyzer).computeBacklogAge, nil},
+	{[]string{"inconsistent_tickets"}, (*Analyzer).computeInconsistentTickets, nil},
+	{[]string{"weekend_weekday_resolution"}, (*Analyzer).computeWeekendWeekdayResolution, nil},
+	{[]string{"avg_resolution_by_creation_weekday"}, (*Analyzer).computeAvgResolutionByWeekday, nil},
+	{[]string{"arrival_heatmap"}, (*Analyzer).computeArrivalHeatmap, nil},
+	{[]string{"same_week_closures", "same_week_closure_pct"}, (*Analyzer).computeSameWeekClosures, nil},
+	{[]string{"category_churn"}, (*Analyzer).computeCategoryChurn, nil},
+	{[]string{"period_deltas"}, (*Analyzer).computePeriodDeltas, nil},
+	{[]string{"hours_since_last_ticket", "ingest_stalled"}, (*Analyzer).computeIngestFreshness, nil},
+	{[]string{"resolution_vs_baseline"}, (*Analyzer).computeResolutionVsBaseline, nil},
+	{[]string{"priority_resolution_correlation"}, (*Analyzer).computePriorityResolutionCorrelation, nil},
+	{[]string{"alert"}, (*Analyzer).computeAlert, nil},
+	{[]string{"category_tree"}, (*Analyzer).computeCategoryTree, func(o Options) bool { return o.Hierarchical }},
+}
+
+// rollingFields are the JSON keys RollingDays sets after Compute
+var rollingFields = []string{"tickets_per_day_rolling", "rolling_window"}
+
+// KnownField reports whether name is a JSON key some metric or
+// RollingDays produces
+func KnownField(name string) bool {
+	for _, f := range rollingFields {
+		if f == name {
+			return true
+		}
+	}
+	for _, m := range metrics {
+		for _, f := range m.fields {
+			if f == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Compute builds the dashboard statistics from t for the metrics
+// opts selects
+func (a *Analyzer) Compute(t []Ticket, opts Options) Summary {
+	var s Summary
+	for _, m := range metrics {
+		if opts.wants(m) {
+			a.runMetric(m, t, &s)
+		}
+	}
+	return s
+}
+
+// AddOptIn runs the opt-in metrics opts enables on top of s, e.g. to extend
+// the cached default summary
+func (a *Analyzer) AddOptIn(t []Ticket, s *Summary, opts Options) {
+	for _, m := range metrics {
+		if m.optIn != nil && opts.wants(m) {
+			a.runMetric(m, t, s)
+		}
+	}
+}
+
+// runMetric computes one metric, recovering from a panic so the rest of the
+// summary survives. Any fields the metric set before failing are rolled back.
+func (a *Analyzer) runMetric(m metric, t []Ticket, s *Summary) {
+	before := *s
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("Metric %s failed: %v", strings.Join(m.fields, ","), err)
+			*s = before
+			s.Partial = true
+			s.FailedMetrics = append(s.FailedMetrics, m.fields...)
+		}
+	}()
+	m.compute(a, t, s)
+}
+
+func wantsAny(fields map[string]bool, names []string) bool {
+	for _, n := range names {
+		if fields[n] {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectFields trims an encoded Summary down to the requested JSON keys
+func SelectFields(s Summary, fields map[string]bool) (map[string]json.RawMessage, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, err
+	}
+	out := make(map[string]json.RawMessage, len(fields))
+	for k, v := range all {
+		if fields[k] {
+			out[k] = v
+		}
+	}
+	if s.Partial {
+		out["partial"], out["failed_metrics"] = all["partial"], all["failed_metrics"]
+	}
+	return out, nil
+}
+
+func (a *Analyzer) computeTicketsPerDay(t []Ticket, s *Summary) {
+	dayMap := make(map[string]int)
+	for _, ticket := range t {
+		day := ticket.CreatedAt.Format(DateLayout)
+		dayMap[day]++
+	}
+	var ticketsPerDay []DayCount
+	for d, c := range dayMap {
+		ticketsPerDay = append(ticketsPerDay, DayCount{Date: d, Count: c})
+	}
+	sort.Slice(ticketsPerDay, func(i, j int) bool { return ticketsPerDay[i].Date < ticketsPerDay[j].Date })
+	s.TicketsPerDay = ticketsPerDay
+	s.TotalDays = len(ticketsPerDay)
+}
+
+// MaxRollingWindow bounds ?window=
+const MaxRollingWindow = 365
+
+// RollingDays adds the window-day rolling average of TicketsPerDay to s:
+// every calendar day from the first to the last, days without tickets
+// counting 0, with the mean of the window days ending on it. Run it
+// before PaginateDays, so the first days of a page still average over the
+// days before it.
+func (a *Analyzer) RollingDays(s Summary, window int) Summary {
+	s.RollingWindow = window
+	s.TicketsPerDayRolling = []DayRolling{}
+	if len(s.TicketsPerDay) == 0 {
+		return s
+	}
+	counts := make(map[string]int, len(s.TicketsPerDay))
+	for _, d := range s.TicketsPerDay {
+		counts[d.Date] = d.Count
+	}
+	first, err1 := time.ParseInLocation(DateLayout, s.TicketsPerDay[0].Date, a.location)
+	last, err2 := time.ParseInLocation(DateLayout, s.TicketsPerDay[len(s.TicketsPerDay)-1].Date, a.location)
+	if err1 != nil || err2 != nil {
+		return s
+	}
+	sum := 0
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		date := day.Format(DateLayout)
+		r := DayRolling{Date: date, Count: counts[date]}
+		sum += r.Count
+		if n := len(s.TicketsPerDayRolling); n >= window {
+			sum -= s.TicketsPerDayRolling[n-window].Count
+		}
+		if len(s.TicketsPerDayRolling) >= window-1 {
+			avg := float64(sum) / float64(window)
+			r.RollingAvg = &avg
+		}
+		s.TicketsPerDayRolling = append(s.TicketsPerDayRolling, r)
+	}
+	return s
+}
+
+// PaginateDays restricts the daily series to a window of TicketsPerDay
+// selected by offset and limit (0 = no limit). Other date-keyed series are
+// trimmed to the same date range so they stay aligned.
+func PaginateDays(s Summary, offset, limit int) Summary {
+	days := s.TicketsPerDay
+	if offset > len(days) {
+		offset = len(days)
+	}
+	days = days[offset:]
+	if limit > 0 && limit < len(days) {
+		days = days[:limit]
+	}
+	s.TicketsPerDay = days
+
+	inPage := func(date string) bool {
+		return len(days) > 0 && date >= days[0].Date && date <= days[len(days)-1].Date
+	}
+	var dominant []DayCategory
+	for _, d := range s.DominantCategoryPerDay {
+		if inPage(d.Date) {
+			dominant = append(dominant, d)
+		}
+	}
+	s.DominantCategoryPerDay = dominant
+	var anomalies []DayAnomaly
+	for _, d := range s.AnomalousDays {
+		if inPage(d.Date) {
+			anomalies = append(anomalies, d)
+		}
+	}
+	s.AnomalousDays = anomalies
+	var trend []DatePct
+	for _, d := range s.SLAComplianceTrend {
+		if inPage(d.Date) {
+			trend = append(trend, d)
+		}
+	}
+	s.SLAComplianceTrend = trend
+	var rolling []DayRolling
+	for _, d := range s.TicketsPerDayRolling {
+		if inPage(d.Date) {
+			rolling = append(rolling, d)
+		}
+	}
+	if s.TicketsPerDayRolling != nil && rolling == nil {
+		rolling = []DayRolling{}
+	}
+	s.TicketsPerDayRolling = rolling
+	return s
+}
+
+// computeTicketsByPriority counts open and closed tickets per priority, in
+// standard priority order
+func (a *Analyzer) computeTicketsByPriority(t []Ticket, s *Summary) {
+	groups := make(map[string]*PriorityStats)
+	for _, ticket := range t {
+		g := groups[ticket.Priority]
+		if g == nil {
+			g = &PriorityStats{Priority: ticket.Priority}
+			groups[ticket.Priority] = g
+		}
+		g.Total++
+		if !a.IsClosed(ticket) {
+			g.Open++
+			continue
+		}
+		g.Closed++
+		if hours, ok := a.ResolutionHours(ticket); ok {
+			g.resolved++
+			g.totalHours += hours
+		}
+	}
+	out := make([]PriorityStats, 0, len(groups))
+	for _, g := range groups {
+		if g.resolved > 0 {
+			avg := g.totalHours / float64(g.resolved)
+			g.AvgHours = &avg
+		}
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool { return PriorityLess(out[i].Priority, out[j].Priority) })
+	s.TicketsByPriority = out
+}
+
+// computeTicketsByAgent counts tickets, open load and average resolution
+// per assignee
+func (a *Analyzer) computeTicketsByAgent(t []Ticket, s *Summary) {
+	groups := make(map[string]*AgentStats)
+	unassigned := 0
+	for _, ticket := range t {
+		if ticket.Assignee == "" {
+			unassigned++
+			continue
+		}
+		// Case-insensitive like ?assignee=, keeping the first spelling seen
+		key := strings.ToLower(ticket.Assignee)
+		g := groups[key]
+		if g == nil {
+			g = &AgentStats{Assignee: ticket.Assignee}
+			groups[key] = g
+		}
+		g.Total++
+		if !a.IsClosed(ticket) {
+			g.Open++
+			continue
+		}
+		g.Closed++
+		if hours, ok := a.ResolutionHours(ticket); ok {
+			g.resolved++
+			g.totalHours += hours
+		}
+	}
+	out := make([]AgentStats, 0, len(groups))
+	for _, g := range groups {
+		if g.resolved > 0 {
+			avg := g.totalHours / float64(g.resolved)
+			g.AvgHours = &avg
+		}
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Open != out[j].Open {
+			return out[i].Open > out[j].Open
+		}
+		if out[i].Total != out[j].Total {
+			return out[i].Total > out[j].Total
+		}
+		return out[i].Assignee < out[j].Assignee
+	})
+	s.TicketsByAgent = out
+	s.UnassignedTickets = unassigned
+}
+
+// computeTicketsByTag counts tickets and averages resolution time per tag
+func (a *Analyzer) computeTicketsByTag(t []Ticket, s *Summary) {
+	groups := make(map[string]*TagStats)
+	untagged := 0
+	for _, ticket := range t {
+		if len(ticket.Tags) == 0 {
+			untagged++
+			continue
+		}
+		hours, resolved := a.ResolutionHours(ticket)
+		for _, tag := range ticket.Tags {
+			g := groups[tag]
+			if g == nil {
+				g = &TagStats{Tag: tag}
+				groups[tag] = g
+			}
+			g.Total++
+			if !a.IsClosed(ticket) {
+				g.Open++
+				continue
+			}
+			g.Closed++
+			if resolved {
+				g.resolved++
+				g.totalHours += hours
+			}
+		}
+	}
+	out := make([]TagStats, 0, len(groups))
+	for _, g := range groups {
+		if g.resolved > 0 {
+			avg := g.totalHours / float64(g.resolved)
+			g.AvgHours = &avg
+		}
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Total != out[j].Total {
+			return out[i].Total > out[j].Total
+		}
+		return out[i].Tag < out[j].Tag
+	})
+	s.TicketsByTag = out
+	s.UntaggedTickets = untagged
+}
+
+// computeCategoryPriorityMatrix counts tickets per (category, priority),
+// sorted by category then standard priority order
+func (a *Analyzer) computeCategoryPriorityMatrix(t []Ticket, s *Summary) {
+	type key struct{ category, priority string }
+	counts := make(map[key]int)
+	for _, ticket := range t {
+		counts[key{ticket.Category, ticket.Priority}]++
+	}
+	matrix := make([]CategoryPriorityCount, 0, len(counts))
+	for k, n := range counts {
+		matrix = append(matrix, CategoryPriorityCount{Category: k.category, Priority: k.priority, Count: n})
+	}
+	sort.Slice(matrix, func(i, j int) bool {
+		if matrix[i].Category != matrix[j].Category {
+			return matrix[i].Category < matrix[j].Category
+		}
+		return PriorityLess(matrix[i].Priority, matrix[j].Priority)
+	})
+	s.CategoryPriorityMatrix = matrix
+}
+
+func (a *Analyzer) computeTopCategories(t []Ticket, s *Summary) {
+	catMap := make(map[string]int)
+	for _, ticket := range t {
+		catMap[ticket.Category]++
+	}
+	var topCategories []CategoryCount
+	for c, n := range catMap {
+		topCategories = append(topCategories, CategoryCount{Category: c, Count: n})
+	}
+	sort.Slice(topCategories, func(i, j int) bool { return topCategories[i].Count > topCategories[j].Count })
+	s.TopCategories = topCategories
+}
+
+// computeDominantCategoryPerDay picks each day's busiest category, breaking
+// ties alphabetically
+func (a *Analyzer) computeDominantCategoryPerDay(t []Ticket, s *Summary) {
+	byDay := make(map[string]map[string]int)
+	for _, ticket := range t {
+		day := ticket.CreatedAt.Format(DateLayout)
+		if byDay[day] == nil {
+			byDay[day] = make(map[string]int)
+		}
+		byDay[day][ticket.Category]++
+	}
+	var out []DayCategory
+	for day, cats := range byDay {
+		best := DayCategory{Date: day}
+		for cat, n := range cats {
+			if n > best.Count || (n == best.Count && cat < best.Category) {
+				best.Category, best.Count = cat, n
+			}
+		}
+		out = append(out, best)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Date < out[j].Date })
+	s.DominantCategoryPerDay = out
+}
+
+// computeAvgResolutionByCat averages resolution hours per category (only closed tickets)
+func (a *Analyzer) computeAvgResolutionByCat(t []Ticket, s *Summary) {
+	catHours := make(map[string][]float64)
+	catRaw := make(map[string][]float64)
+	for _, ticket := range t {
+		hours, ok := a.ResolutionHours(ticket)
+		if !ok {
+			continue
+		}
+		catHours[ticket.Category] = append(catHours[ticket.Category], hours)
+		raw, _ := a.rawResolutionHours(ticket)
+		catRaw[ticket.Category] = append(catRaw[ticket.Category], raw)
+	}
+	var avgByCat []CategoryAvgHours
+	for cat, hours := range catHours {
+		raw := catRaw[cat]
+		var sum, rawSum float64
+		for i := range hours {
+			sum += hours[i]
+			rawSum += raw[i]
+		}
+		sort.Float64s(raw)
+		avgByCat = append(avgByCat, CategoryAvgHours{
+			Category:    cat,
+			AvgHours:    sum / float64(len(hours)),
+			RawAvgHours: rawSum / float64(len(raw)),
+			MedianHours: percentile(raw, 50),
+			P90Hours:    percentile(raw, 90),
+			P99Hours:    percentile(raw, 99),
+		})
+	}
+	sort.Slice(avgByCat, func(i, j int) bool { return avgByCat[i].Category < avgByCat[j].Category })
+	s.AvgResolutionHoursByCat = avgByCat
+}
+
+func (a *Analyzer) computeCategoriesWithoutResolution(t []Ticket, s *Summary) {
+	resolved := make(map[string]bool)
+	for _, ticket := range t {
+		_, ok := a.ResolutionHours(ticket)
+		resolved[ticket.Category] = resolved[ticket.Category] || ok
+	}
+	var cats []string
+	for cat, ok := range resolved {
+		if !ok {
+			cats = append(cats, cat)
+		}
+	}
+	sort.Strings(cats)
+	s.CategoriesWithoutResolutionData = cats
+}
+
+// computeConsistencyScores maps each category's coefficient of variation
+// onto 0-100 as 100/(1+CV). Categories need two closed tickets for a
+// standard deviation; a zero mean with zero spread scores 100.
+func (a *Analyzer) computeConsistencyScores(t []Ticket, s *Summary) {
+	byCat := make(map[string][]float64)
+	for _, ticket := range t {
+		if h, ok := a.ResolutionHours(ticket); ok {
+			byCat[ticket.Category] = append(byCat[ticket.Category], h)
+		}
+	}
+	var out []CategoryScore
+	for cat, hours := range byCat {
+		if len(hours) < 2 {
+			continue
+		}
+		var sum float64
+		for _, h := range hours {
+			sum += h
+		}
+		mean := sum / float64(len(hours))
+		var sq float64
+		for _, h := range hours {
+			sq += (h - mean) * (h - mean)
+		}
+		sd := math.Sqrt(sq / float64(len(hours)-1))
+		score := 100.0
+		if mean > 0 {
+			score = 100 / (1 + sd/mean)
+		} else if sd > 0 {
+			score = 0
+		}
+		out = append(out, CategoryScore{
+			Category:    cat,
+			Closed:      len(hours),
+			MeanHours:   mean,
+			StdDevHours: sd,
+			Score:       score,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Category < out[j].Category
+	})
+	s.ConsistencyScoreByCategory = out
+}
+
+func (a *Analyzer) computeResolutionBoxplots(t []Ticket, s *Summary) {
+	type sample struct {
+		id    int
+		hours float64
+	}
+	byCat := make(map[string][]sample)
+	for _, ticket := range t {
+		if h, ok := a.rawResolutionHours(ticket); ok {
+			byCat[ticket.Category] = append(byCat[ticket.Category], sample{ticket.ID, h})
+		}
+	}
+	var out []CategoryBoxplot
+	for cat, samples := range byCat {
+		sort.Slice(samples, func(i, j int) bool { return samples[i].hours < samples[j].hours })
+		sorted := make([]float64, len(samples))
+		for i, smp := range samples {
+			sorted[i] = smp.hours
+		}
+		box := CategoryBoxplot{
+			Category: cat,
+			Count:    len(sorted),
+			Min:      sorted[0],
+			Q1:       percentile(sorted, 25),
+			Median:   percentile(sorted, 50),
+			Q3:       percentile(sorted, 75),
+			Max:      sorted[len(sorted)-1],
+			Outliers: []int{},
+		}
+		fence := 1.5 * (box.Q3 - box.Q1)
+		for _, smp := range samples {
+			if smp.hours < box.Q1-fence || smp.hours > box.Q3+fence {
+				box.Outliers = append(box.Outliers, smp.id)
+			}
+		}
+		sort.Ints(box.Outliers)
+		out = append(out, box)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Category < out[j].Category })
+	s.ResolutionBoxplotByCategory = out
+}
+
+// percentile returns the p-th percentile (0-100) of an ascending slice,
+// interpolating linearly between closest ranks
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	if lo >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	frac := pos - float64(lo)
+	return sorted[lo] + frac*(sorted[lo+1]-sorted[lo])
+}
+
+// ResolutionHours returns how long a closed ticket took, clamped to
+// -cap-resolution-hours; ok is false for open tickets. Every resolution
+// average goes through here so the cap applies consistently.
+func (a *Analyzer) ResolutionHours(t Ticket) (hours float64, ok bool) {
+	hours, ok = a.rawResolutionHours(t)
+	if ok && a.capResolutionHours > 0 && hours > a.capResolutionHours {
+		hours = a.capResolutionHours
+	}
+	return hours, ok
+}
+
+// rawResolutionHours is ResolutionHours without the cap. Tickets closed by
+// status alone (-open-rule=status) have no resolution time.
+func (a *Analyzer) rawResolutionHours(t Ticket) (hours float64, ok bool) {
+	closedAt, ok := a.ClosedTime(t)
+	if !ok {
+		return 0, false
+	}
+	return closedAt.Sub(t.CreatedAt).Hours(), true
+}
+
+// priorityRanks orders common priority labels from most to least urgent
+var priorityRanks = map[string]int{
+	"critical": 0, "urgent": 0, "p1": 0,
+	"high": 1, "p2": 1,
+	"medium": 2, "normal": 2, "p3": 2,
+	"low": 3, "p4": 3,
+}
+
+// priorityRank returns a label's urgency rank; unknown labels sort last
+func priorityRank(p string) (rank int, known bool) {
+	rank, known = priorityRanks[strings.ToLower(strings.TrimSpace(p))]
+	if !known {
+		return len(priorityRanks), false
+	}
+	return rank, true
+}
+
+// PriorityLess sorts by the standard priority order, then alphabetically
+func PriorityLess(a, b string) bool {
+	ra, _ := priorityRank(a)
+	rb, _ := priorityRank(b)
+	if ra != rb {
+		return ra < rb
+	}
+	return a < b
+}
+
+// inList reports whether v matches any entry, ignoring case
+func inList(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// CountOpenClosed splits t according to -open-rule
+func (a *Analyzer) CountOpenClosed(t []Ticket) (open, closed int) {
+	for _, ticket := range t {
+		if a.IsClosed(ticket) {
+			closed++
+		} else {
+			open++
+		}
+	}
+	return open, closed
+}
+
+func (a *Analyzer) computeOpenVsClosed(t []Ticket, s *Summary) {
+	open, closed := a.CountOpenClosed(t)
+	s.OpenVsClosed = OpenClosedCounts{Open: open, Closed: closed}
+}
+
+func (a *Analyzer) computeTotalTickets(t []Ticket, s *Summary) {
+	s.TotalTickets = len(t)
+}
+
+func (a *Analyzer) computeOpenTickets(t []Ticket, s *Summary) {
+	s.OpenTickets, _ = a.CountOpenClosed(t)
+}
+
+func (a *Analyzer) computeClosedTickets(t []Ticket, s *Summary) {
+	_, s.ClosedTickets = a.CountOpenClosed(t)
+}
+
+func (a *Analyzer) computeActivityDays(t []Ticket, s *Summary) {
+	days := DailyCounts(t)
+	s.DateRangeDays = len(days)
+	s.DaysWithActivity = 0
+	for _, d := range days {
+		if d.Count > 0 {
+			s.DaysWithActivity++
+		}
+	}
+}
+
+// computeVelocity counts closures in the 7 days up to the reference time
+// against the 7 days before that
+func (a *Analyzer) computeVelocity(t []Ticket, s *Summary) {
+	now := a.ReferenceTime()
+	weekAgo, twoWeeksAgo := now.AddDate(0, 0, -7), now.AddDate(0, 0, -14)
+	var current, prior int
+	for _, ticket := range t {
+		closedAt, ok := a.ClosedTime(ticket)
+		if !ok || closedAt.After(now) {
+			continue
+		}
+		switch {
+		case closedAt.After(weekAgo):
+			current++
+		case closedAt.After(twoWeeksAgo):
+			prior++
+		}
+	}
+	s.CurrentVelocity = float64(current) / 7
+	switch {
+	case current > prior:
+		s.VelocityTrend = "up"
+	case current < prior:
+		s.VelocityTrend = "down"
+	default:
+		s.VelocityTrend = "flat"
+	}
+}
+
+func (a *Analyzer) computeForecast(t []Ticket, s *Summary) {
+	s.ForecastNextWeek, s.ForecastLow, s.ForecastHigh, s.ForecastMethod = a.forecastNextWeek(t)
+}
+
+// computeAvgResolutionByReassignments groups closed tickets that carry a
+// reassignment_count by that count
+func (a *Analyzer) computeAvgResolutionByReassignments(t []Ticket, s *Summary) {
+	groups := make(map[int]*ReassignStat)
+	for _, ticket := range t {
+		hours, ok := a.ResolutionHours(ticket)
+		if !ok || ticket.Reassignments == nil {
+			continue
+		}
+		n := *ticket.Reassignments
+		g := groups[n]
+		if g == nil {
+			g = &ReassignStat{Reassignments: n}
+			groups[n] = g
+		}
+		g.Tickets++
+		g.AvgHours += hours
+	}
+	var stats []ReassignStat
+	for _, g := range groups {
+		g.AvgHours /= float64(g.Tickets)
+		stats = append(stats, *g)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Reassignments < stats[j].Reassignments })
+	s.AvgResolutionByReassignmentCount = stats
+}
+
+// ReopenCount is how often a ticket was reopened: the number of times its
+// status history leaves a -closed-statuses status for another one, or its
+// reopened_count. ok is false when it has neither.
+func (a *Analyzer) ReopenCount(t Ticket) (n int, ok bool) {
+	if len(t.History) > 0 {
+		return a.historyReopens(t.History), true
+	}
+	if t.Reopens != nil {
+		return *t.Reopens, true
+	}
+	return 0, false
+}
+
+// computeReopenRateByPriority reports, per priority, the fraction of closed
+// tickets reopened at least once
+func (a *Analyzer) computeReopenRateByPriority(t []Ticket, s *Summary) {
+	groups := make(map[string]*PriorityRate)
+	for _, ticket := range t {
+		n, ok := a.ReopenCount(ticket)
+		if !a.IsClosed(ticket) || !ok {
+			continue
+		}
+		g := groups[ticket.Priority]
+		if g == nil {
+			g = &PriorityRate{Priority: ticket.Priority}
+			groups[ticket.Priority] = g
+		}
+		g.Closed++
+		if n > 0 {
+			g.Reopened++
+		}
+	}
+	var rates []PriorityRate
+	for _, g := range groups {
+		g.Rate = float64(g.Reopened) / float64(g.Closed)
+		rates = append(rates, *g)
+	}
+	sort.Slice(rates, func(i, j int) bool { return PriorityLess(rates[i].Priority, rates[j].Priority) })
+	s.ReopenRateByPriority = rates
+}
+
+// computeReopenRateByCategory is computeReopenRateByPriority per category,
+// highest rate first
+func (a *Analyzer) computeReopenRateByCategory(t []Ticket, s *Summary) {
+	groups := make(map[string]*CategoryRate)
+	for _, ticket := range t {
+		n, ok := a.ReopenCount(ticket)
+		if !a.IsClosed(ticket) || !ok {
+			continue
+		}
+		g := groups[ticket.Category]
+		if g == nil {
+			g = &CategoryRate{Category: ticket.Category}
+			groups[ticket.Category] = g
+		}
+		g.Closed++
+		if n > 0 {
+			g.Reopened++
+		}
+	}
+	var rates []CategoryRate
+	for _, g := range groups {
+		g.Rate = float64(g.Reopened) / float64(g.Closed)
+		rates = append(rates, *g)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].Rate != rates[j].Rate {
+			return rates[i].Rate > rates[j].Rate
+		}
+		return rates[i].Category < rates[j].Category
+	})
+	s.ReopenRateByCategory = rates
+}
+
+// computeAvgReopensBeforeClose averages how many reopens closed tickets went
+// through, counting only tickets reopened at least once
+func (a *Analyzer) computeAvgReopensBeforeClose(t []Ticket, s *Summary) {
+	var total, n int
+	groups := make(map[string]*CategoryAvgReopens)
+	for _, ticket := range t {
+		reopens, ok := a.ReopenCount(ticket)
+		if !a.IsClosed(ticket) || !ok || reopens < 1 {
+			continue
+		}
+		total += reopens
+		n++
+		g := groups[ticket.Category]
+		if g == nil {
+			g = &CategoryAvgReopens{Category: ticket.Category}
+			groups[ticket.Category] = g
+		}
+		g.Tickets++
+		g.total += reopens
+	}
+	s.AvgReopensBeforeClose = 0
+	if n > 0 {
+		s.AvgReopensBeforeClose = float64(total) / float64(n)
+	}
+	var out []CategoryAvgReopens
+	for _, g := range groups {
+		g.AvgReopens = float64(g.total) / float64(g.Tickets)
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].AvgReopens != out[j].AvgReopens {
+			return out[i].AvgReopens > out[j].AvgReopens
+		}
+		return out[i].Category < out[j].Category
+	})
+	s.AvgReopensBeforeCloseByCat = out
+}
+
+func (a *Analyzer) computeAnomalousDays(t []Ticket, s *Summary) {
+	s.AnomalousDays = FindAnomalies(DailyCounts(t), a.anomalyMethod, a.anomalyWindow, a.anomalySigma)
+}
+
+// slaTrendDays is the trailing window of sla_compliance_trend
+const slaTrendDays = 30
+
+// computeSLAComplianceTrend walks every day from the first closure to the
+// last, scoring closures of priorities that have an -sla target
+func (a *Analyzer) computeSLAComplianceTrend(t []Ticket, s *Summary) {
+	type tally struct{ closed, met int }
+	byDay := make(map[string]*tally)
+	first, last := "", ""
+	for _, ticket := range t {
+		closedAt, ok := a.ClosedTime(ticket)
+		target, tracked := a.slaFor(ticket.Priority)
+		if !ok || !tracked {
+			continue
+		}
+		d := closedAt.Format(DateLayout)
+		if byDay[d] == nil {
+			byDay[d] = &tally{}
+		}
+		byDay[d].closed++
+		if closedAt.Sub(ticket.CreatedAt) <= target {
+			byDay[d].met++
+		}
+		if first == "" || d < first {
+			first = d
+		}
+		if d > last {
+			last = d
+		}
+	}
+	s.SLAComplianceTrend = nil
+	if first == "" {
+		return
+	}
+
+	start, _ := time.Parse(DateLayout, first)
+	end, _ := time.Parse(DateLayout, last)
+	var trend []DatePct
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		var closed, met int
+		for back := 0; back < slaTrendDays; back++ {
+			if day := byDay[d.AddDate(0, 0, -back).Format(DateLayout)]; day != nil {
+				closed += day.closed
+				met += day.met
+			}
+		}
+		point := DatePct{Date: d.Format(DateLayout), Closures: closed}
+		if closed > 0 {
+			pct := 100 * float64(met) / float64(closed)
+			point.Pct = &pct
+		}
+		trend = append(trend, point)
+	}
+	s.SLAComplianceTrend = trend
+}
+
+// computeUrgentOpenTickets lists the oldest open tickets in -urgent-priorities,
+// capped at -urgent-limit
+func (a *Analyzer) computeUrgentOpenTickets(t []Ticket, s *Summary) {
+	now := a.ReferenceTime()
+	var urgent []OpenTicket
+	for _, ticket := range t {
+		if a.IsClosed(ticket) || !inList(a.urgentPriorities, ticket.Priority) {
+			continue
+		}
+		urgent = append(urgent, a.NewOpenTicket(ticket, now))
+	}
+	sort.Slice(urgent, func(i, j int) bool { return urgent[i].AgeHours > urgent[j].AgeHours })
+	if len(urgent) > a.urgentLimit {
+		urgent = urgent[:a.urgentLimit]
+	}
+	s.UrgentOpenTickets = urgent
+}
+
+// computeAtRiskTickets lists open tickets that have used at least
+// -at-risk-fraction of their priority's SLA without breaching it yet,
+// closest to breaching first
+func (a *Analyzer) computeAtRiskTickets(t []Ticket, s *Summary) {
+	now := a.ReferenceTime()
+	var atRisk []OpenTicket
+	for _, ticket := range t {
+		if a.IsClosed(ticket) {
+			continue
+		}
+		ot := a.NewOpenTicket(ticket, now)
+		if ot.SLAHours > 0 && !ot.SLABreached && ot.SLAUsed >= a.atRiskFraction {
+			atRisk = append(atRisk, ot)
+		}
+	}
+	sort.Slice(atRisk, func(i, j int) bool { return atRisk[i].SLAUsed > atRisk[j].SLAUsed })
+	s.AtRiskTickets = atRisk
+}
+
+// computeLongestOpenByCategory reports each category's oldest open ticket,
+// longest-festering first
+func (a *Analyzer) computeLongestOpenByCategory(t []Ticket, s *Summary) {
+	now := a.ReferenceTime()
+	oldest := make(map[string]Ticket)
+	for _, ticket := range t {
+		if a.IsClosed(ticket) {
+			continue
+		}
+		if cur, ok := oldest[ticket.Category]; !ok || ticket.CreatedAt.Before(cur.CreatedAt) {
+			oldest[ticket.Category] = ticket
+		}
+	}
+	var out []CategoryDuration
+	for cat, ticket := range oldest {
+		out = append(out, CategoryDuration{
+			Category: cat,
+			TicketID: ticket.ID,
+			AgeHours: now.Sub(ticket.CreatedAt).Hours(),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].AgeHours != out[j].AgeHours {
+			return out[i].AgeHours > out[j].AgeHours
+		}
+		return out[i].Category < out[j].Category
+	})
+	s.LongestOpenByCategory = out
+}
+
+// backlogAgeBuckets are the backlog_age bucket upper bounds in days; the
+// last bucket has none
+var backlogAgeBuckets = []struct {
+	label   string
+	maxDays int
+}{
+	{"<1d", 1},
+	{"1-3d", 3},
+	{"3-7d", 7},
+	{"7-30d", 30},
+	{">30d", 0},
+}
+
+func (a *Analyzer) computeBacklogAge(t []Ticket, s *Summary) {
+	buckets := make([]AgeBucket, len(backlogAgeBuckets))
+	lo := 0
+	for i, b := range backlogAgeBuckets {
+		buckets[i] = AgeBucket{Label: b.label, MinDays: lo}
+		if b.maxDays > 0 {
+			hi := b.maxDays
+			buckets[i].MaxDays = &hi
+			lo = hi
+		}
+	}
+
+	now := a.ReferenceTime()
+	last := len(buckets) - 1
+	for _, ticket := range t {
+		if a.IsClosed(ticket) {
+			continue
+		}
+		days := now.Sub(ticket.CreatedAt).Hours() / 24
+		i := sort.Search(last, func(i int) bool { return days < float64(backlogAgeBuckets[i].maxDays) })
+		buckets[i].Count++
+	}
+	s.BacklogAge = buckets
+}
+
+// computeInconsistentTickets lists tickets with closed_at set but an open
+// status, or a closed status but no closed_at
+func (a *Analyzer) computeInconsistentTickets(t []Ticket, s *Summary) {
+	var out []Ticket
+	for _, ticket := range t {
+		if (ticket.ClosedAt != nil) != inList(a.closedStatuses, ticket.Status) {
+			out = append(out, ticket)
+		}
+	}
+	s.InconsistentTickets = out
+}
+
+// computeWeekendWeekdayResolution splits tickets by whether they were created
+// on a Saturday or Sunday in the configured time zone
+func (a *Analyzer) computeWeekendWeekdayResolution(t []Ticket, s *Summary) {
+	var weekend, weekday ResolutionGroup
+	for _, ticket := range t {
+		g := &weekday
+		switch ticket.CreatedAt.In(a.location).Weekday() {
+		case time.Saturday, time.Sunday:
+			g = &weekend
+		}
+		g.Tickets++
+		if hours, ok := a.ResolutionHours(ticket); ok {
+			g.Closed++
+			g.AvgHours += hours
+		}
+	}
+	for _, g := range []*ResolutionGroup{&weekend, &weekday} {
+		if g.Closed > 0 {
+			g.AvgHours /= float64(g.Closed)
+		}
+	}
+	s.WeekendWeekdayResolution = WeekendWeekdayResolution{Weekend: weekend, Weekday: weekday}
+}
+
+// computeAvgResolutionByWeekday averages resolution hours by the local
+// weekday a ticket was created, listing all seven days from -week-start
+func (a *Analyzer) computeAvgResolutionByWeekday(t []Ticket, s *Summary) {
+	var closed [7]int
+	var hours [7]float64
+	for _, ticket := range t {
+		if h, ok := a.ResolutionHours(ticket); ok {
+			wd := ticket.CreatedAt.In(a.location).Weekday()
+			closed[wd]++
+			hours[wd] += h
+		}
+	}
+	out := make([]WeekdayAvgHours, 0, 7)
+	for i := 0; i < 7; i++ {
+		wd := (a.weekStart + time.Weekday(i)) % 7
+		row := WeekdayAvgHours{Weekday: wd.String(), Closed: closed[wd]}
+		if closed[wd] > 0 {
+			row.AvgHours = hours[wd] / float64(closed[wd])
+		}
+		out = append(out, row)
+	}
+	s.AvgResolutionByCreationWeekday = out
+}
+
+// computeArrivalHeatmap buckets created_at by local weekday and hour. The
+// peaks are the busiest weekday and hour, earliest first on ties.
+func (a *Analyzer) computeArrivalHeatmap(t []Ticket, s *Summary) {
+	var cells [7][24]int
+	hasTimes := false
+	for _, ticket := range t {
+		at := ticket.CreatedAt.In(a.location)
+		cells[at.Weekday()][at.Hour()]++
+		if !hasTimes && (at.Hour() != 0 || at.Minute() != 0 || at.Second() != 0 || at.Nanosecond() != 0) {
+			hasTimes = true
+		}
+	}
+
+	h := ArrivalHeatmap{HasTimes: hasTimes, ByWeekday: make([]WeekdayArrivals, 0, 7)}
+	if hasTimes {
+		h.ByHour = make([]int, 24)
+	}
+	peak := -1
+	for i := 0; i < 7; i++ {
+		wd := (a.weekStart + time.Weekday(i)) % 7
+		row := WeekdayArrivals{Weekday: wd.String()}
+		if hasTimes {
+			row.Hours = cells[wd][:]
+		}
+		for hour, n := range cells[wd] {
+			row.Count += n
+			if hasTimes {
+				h.ByHour[hour] += n
+			}
+		}
+		if row.Count > peak {
+			peak, h.PeakWeekday = row.Count, row.Weekday
+		}
+		h.ByWeekday = append(h.ByWeekday, row)
+	}
+	if len(t) == 0 {
+		h.PeakWeekday = ""
+	}
+	if hasTimes {
+		best := 0
+		for hour, n := range h.ByHour {
+			if n > h.ByHour[best] {
+				best = hour
+			}
+		}
+		h.PeakHour = &best
+	}
+	s.ArrivalHeatmap = h
+}
+
+func (a *Analyzer) computeSameWeekClosures(t []Ticket, s *Summary) {
+	var closed, sameWeek int
+	for _, ticket := range t {
+		closedAt, ok := a.ClosedTime(ticket)
+		if !ok {
+			continue
+		}
+		closed++
+		if a.StartOfWeek(ticket.CreatedAt).Equal(a.StartOfWeek(closedAt)) {
+			sameWeek++
+		}
+	}
+	s.SameWeekClosures = sameWeek
+	s.SameWeekClosurePct = 0
+	if closed > 0 {
+		s.SameWeekClosurePct = 100 * float64(sameWeek) / float64(closed)
+	}
+}
+
+// computeCategoryTree groups slash-separated categories under their parents
+func (a *Analyzer) computeCategoryTree(t []Ticket, s *Summary) {
+	root := &CategoryNode{}
+	index := make(map[string]*CategoryNode)
+	for _, ticket := range t {
+		hours, closed := a.ResolutionHours(ticket)
+		parent, path := root, ""
+		for _, part := range strings.Split(ticket.Category, "/") {
+			part = strings.TrimSpace(part)
+			if path != "" {
+				path += "/"
+			}
+			path += part
+			node := index[path]
+			if node == nil {
+				node = &CategoryNode{Name: part, Path: path}
+				index[path] = node
+				parent.Children = append(parent.Children, node)
+			}
+			node.Count++
+			if closed {
+				node.closed++
+				node.totalHours += hours
+			} else {
+				node.Open++
+			}
+			parent = node
+		}
+	}
+	finishCategoryNodes(root.Children)
+	s.CategoryTree = root.Children
+}
+
+func finishCategoryNodes(nodes []*CategoryNode) {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	for _, n := range nodes {
+		if n.closed > 0 {
+			n.AvgHours = n.totalHours / float64(n.closed)
+		}
+		finishCategoryNodes(n.Children)
+	}
+}
+
+func (a *Analyzer) computeCategoryChurn(t []Ticket, s *Summary) {
+	churn := CategoryChurn{Granularity: a.granularity, NewCategories: []string{}, DisappearedCategories: []string{}}
+	if len(t) == 0 {
+		s.CategoryChurn = churn
+		return
+	}
+	latest := t[0].CreatedAt
+	for _, ticket := range t {
+		if ticket.CreatedAt.After(latest) {
+			latest = ticket.CreatedAt
+		}
+	}
+	cur := a.periodStart(latest)
+	prior := a.previousPeriod(cur)
+	churn.Period = cur.Format(DateLayout)
+	churn.PriorPeriod = prior.Format(DateLayout)
+
+	inCur, inPrior := make(map[string]bool), make(map[string]bool)
+	for _, ticket := range t {
+		switch a.periodStart(ticket.CreatedAt) {
+		case cur:
+			inCur[ticket.Category] = true
+		case prior:
+			inPrior[ticket.Category] = true
+		}
+	}
+	for cat := range inCur {
+		if inPrior[cat] {
+			churn.Persisted++
+		} else {
+			churn.NewCategories = append(churn.NewCategories, cat)
+		}
+	}
+	for cat := range inPrior {
+		if !inCur[cat] {
+			churn.DisappearedCategories = append(churn.DisappearedCategories, cat)
+		}
+	}
+	sort.Strings(churn.NewCategories)
+	sort.Strings(churn.DisappearedCategories)
+	churn.New, churn.Disappeared = len(churn.NewCategories), len(churn.DisappearedCategories)
+	s.CategoryChurn = churn
+}
+
+func (a *Analyzer) computePeriodDeltas(t []Ticket, s *Summary) {
+	now := a.ReferenceTime()
+	cur := a.periodStart(now)
+	prior := a.previousPeriod(cur)
+
+	var created [2]int
+	var closed [2]int
+	var hours [2]float64
+	for _, ticket := range t {
+		switch a.periodStart(ticket.CreatedAt) {
+		case cur:
+			created[0]++
+		case prior:
+			created[1]++
+		}
+		closedAt, ok := a.ClosedTime(ticket)
+		if !ok || closedAt.After(now) {
+			continue
+		}
+		h, _ := a.ResolutionHours(ticket)
+		switch a.periodStart(closedAt) {
+		case cur:
+			closed[0]++
+			hours[0] += h
+		case prior:
+			closed[1]++
+			hours[1] += h
+		}
+	}
+	var avg [2]float64
+	for i := range avg {
+		if closed[i] > 0 {
+			avg[i] = hours[i] / float64(closed[i])
+		}
+	}
+
+	s.PeriodDeltas = PeriodDeltas{
+		Granularity:        a.granularity,
+		Period:             cur.Format(DateLayout),
+		PriorPeriod:        prior.Format(DateLayout),
+		Volume:             NewDelta(float64(created[0]), float64(created[1])),
+		Backlog:            NewDelta(float64(a.OpenAt(t, now)), float64(a.OpenAt(t, cur))),
+		AvgResolutionHours: NewDelta(avg[0], avg[1]),
+	}
+}
+
+// OpenAt counts tickets created before at and not yet closed by then.
+// Tickets closed by status alone have no closing time and count as closed.
+func (a *Analyzer) OpenAt(t []Ticket, at time.Time) int {
+	n := 0
+	for _, ticket := range t {
+		if !ticket.CreatedAt.Before(at) {
+			continue
+		}
+		if closedAt, ok := a.ClosedTime(ticket); ok {
+			if closedAt.After(at) {
+				n++
+			}
+		} else if !a.IsClosed(ticket) {
+			n++
+		}
+	}
+	return n
+}
+
+func (a *Analyzer) computeIngestFreshness(t []Ticket, s *Summary) {
+	s.HoursSinceLastTicket, s.IngestStalled = 0, false
+	if len(t) == 0 {
+		return
+	}
+	latest := t[0].CreatedAt
+	for _, ticket := range t {
+		if ticket.CreatedAt.After(latest) {
+			latest = ticket.CreatedAt
+		}
+	}
+	gap := a.ReferenceTime().Sub(latest)
+	s.HoursSinceLastTicket = gap.Hours()
+	s.IngestStalled = a.maxIngestGap > 0 && gap > a.maxIngestGap
+}
+
+// computeResolutionVsBaseline splits tickets by created_at into the
+// baseline window and everything created after it
+func (a *Analyzer) computeResolutionVsBaseline(t []Ticket, s *Summary) {
+	s.ResolutionVsBaseline = nil
+	if a.baselineFrom.IsZero() {
+		return
+	}
+	cmp := &BaselineComparison{BaselineFrom: a.baselineFromLabel, BaselineTo: a.baselineToLabel}
+	var baseSum, curSum float64
+	for _, ticket := range t {
+		hours, ok := a.ResolutionHours(ticket)
+		if !ok || ticket.CreatedAt.Before(a.baselineFrom) {
+			continue
+		}
+		if ticket.CreatedAt.Before(a.baselineEnd) {
+			cmp.BaselineClosed++
+			baseSum += hours
+		} else {
+			cmp.CurrentClosed++
+			curSum += hours
+		}
+	}
+	if cmp.BaselineClosed > 0 {
+		cmp.BaselineAvgHours = baseSum / float64(cmp.BaselineClosed)
+	}
+	if cmp.CurrentClosed > 0 {
+		cmp.CurrentAvgHours = curSum / float64(cmp.CurrentClosed)
+	}
+	if cmp.BaselineClosed > 0 && cmp.CurrentClosed > 0 && cmp.BaselineAvgHours > 0 {
+		pct := 100 * (cmp.CurrentAvgHours - cmp.BaselineAvgHours) / cmp.BaselineAvgHours
+		cmp.PctChange = &pct
+	}
+	s.ResolutionVsBaseline = cmp
+}
+
+// computePriorityResolutionCorrelation ranks closed tickets with a known
+// priority by level (Low lowest) and by uncapped resolution hours. Capping
+// would only add ties, so the raw value is used.
+func (a *Analyzer) computePriorityResolutionCorrelation(t []Ticket, s *Summary) {
+	var levels, hours []float64
+	for _, ticket := range t {
+		rank, known := priorityRank(ticket.Priority)
+		h, closed := a.rawResolutionHours(ticket)
+		if !known || !closed {
+			continue
+		}
+		levels = append(levels, float64(-rank))
+		hours = append(hours, h)
+	}
+	s.PriorityResolutionCorrelation = spearman(levels, hours)
+}
+
+// spearman returns the rank correlation of x and y, or 0 when either side
+// has no variation
+func spearman(x, y []float64) float64 {
+	if len(x) < 2 {
+		return 0
+	}
+	rx, ry := averageRanks(x), averageRanks(y)
+	n := float64(len(rx))
+	var mx, my float64
+	for i := range rx {
+		mx += rx[i]
+		my += ry[i]
+	}
+	mx, my = mx/n, my/n
+	var cov, vx, vy float64
+	for i := range rx {
+		dx, dy := rx[i]-mx, ry[i]-my
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+	if vx == 0 || vy == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(vx*vy)
+}
+
+// averageRanks assigns 1-based ranks, giving tied values their mean rank
+func averageRanks(v []float64) []float64 {
+	idx := make([]int, len(v))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(a, b int) bool { return v[idx[a]] < v[idx[b]] })
+	ranks := make([]float64, len(v))
+	for i := 0; i < len(idx); {
+		j := i
+		for j+1 < len(idx) && v[idx[j+1]] == v[idx[i]] {
+			j++
+		}
+		mean := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			ranks[idx[k]] = mean
+		}
+		i = j + 1
+	}
+	return ranks
+}
+
+func (a *Analyzer) computeAlert(t []Ticket, s *Summary) {
+	s.Alert = a.currentAlert()
+}
+
+// forecastNextWeek estimates next week's ticket volume as the mean of the
+// trailing 7-day windows ending at ReferenceTime, counting only windows the
+// data covers in full. The low/high bounds are a rough 95% interval
+// (mean ± 1.96 stddev) clamped at zero.
+func (a *Analyzer) forecastNextWeek(t []Ticket) (forecast, low, high int, method string) {
+	if len(t) == 0 {
+		return 0, 0, 0, "estimate: no data"
+	}
+
+	ref := a.ReferenceTime()
+	first := t[0].CreatedAt
+	for _, ticket := range t {
+		if ticket.CreatedAt.Before(first) {
+			first = ticket.CreatedAt
+		}
+	}
+
+	// A window starting before the first ticket would average in days
+	// nothing was recorded for, so only whole weeks count, up to
+	// forecastWeeks
+	const week = 7 * 24 * time.Hour
+	weeks := int(ref.Sub(first) / week)
+	if weeks > forecastWeeks {
+		weeks = forecastWeeks
+	}
+	if weeks < 1 {
+		return 0, 0, 0, "estimate: less than a week of data"
+	}
+	counts := make([]float64, weeks)
+	for _, ticket := range t {
+		age := ref.Sub(ticket.CreatedAt)
+		if age < 0 {
+			continue
+		}
+		if w := int(age / week); w < weeks {
+			counts[w]++
+		}
+	}
+
+	var sum float64
+	for _, c := range counts {
+		sum += c
+	}
+	mean := sum / float64(weeks)
+
+	var spread float64
+	if weeks > 1 {
+		var sq float64
+		for _, c := range counts {
+			sq += (c - mean) * (c - mean)
+		}
+		spread = 1.96 * math.Sqrt(sq/float64(weeks-1))
+	}
+
+	forecast = int(math.Round(mean))
+	low = int(math.Max(0, math.Round(mean-spread)))
+	high = int(math.Round(mean + spread))
+	method = "estimate: mean of last " + strconv.Itoa(weeks) + " week(s)"
+	return forecast, low, high, method
+}
@@ -0,0 +1,59 @@
+package analytics
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// benchTickets returns n tickets spread over 90 days, two thirds of them
+// closed, with a fixed seed so runs compare
+func benchTickets(n int) []Ticket {
+	r := rand.New(rand.NewSource(1))
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	categories := []string{"VPN", "Password Reset", "Printer", "Network", "Email"}
+	priorities := []string{"Low", "Medium", "High"}
+	t := make([]Ticket, n)
+	for i := range t {
+		created := start.Add(time.Duration(r.Int63n(int64(90 * 24 * time.Hour))))
+		t[i] = Ticket{
+			ID:        i + 1,
+			CreatedAt: created,
+			Category:  categories[r.Intn(len(categories))],
+			Priority:  priorities[r.Intn(len(priorities))],
+			Status:    "Open",
+			Assignee:  "agent" + strconv.Itoa(r.Intn(20)),
+			Tags:      []string{"tag" + strconv.Itoa(r.Intn(8))},
+		}
+		if r.Intn(3) > 0 {
+			closed := created.Add(time.Duration(r.Int63n(int64(10 * 24 * time.Hour))))
+			t[i].ClosedAt = &closed
+			t[i].Status = "Closed"
+		}
+	}
+	return t
+}
+
+func benchAnalyzer() *Analyzer {
+	s := DefaultSettings()
+	s.AsOf = time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	return New(s)
+}
+
+func BenchmarkCompute(b *testing.B) {
+	a, t := benchAnalyzer(), benchTickets(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		a.Compute(t, Options{})
+	}
+}
+
+func BenchmarkComputeSingleField(b *testing.B) {
+	a, t := benchAnalyzer(), benchTickets(10000)
+	opts := Options{Fields: map[string]bool{"total_tickets": true}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		a.Compute(t, opts)
+	}
+}
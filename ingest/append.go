@@ -0,0 +1,148 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// Append writes tickets to the end of the data file at path, in format,
+// so the next load reads them. CSV rows follow the file's own header order.
+func (l *Loader) Append(path, format string, t []analytics.Ticket) error {
+	var buf bytes.Buffer
+	if format == "jsonl" {
+		enc := json.NewEncoder(&buf)
+		for _, ticket := range t {
+			if err := enc.Encode(ticket); err != nil {
+				return err
+			}
+		}
+	} else {
+		header, err := l.csvHeader(path)
+		if err != nil {
+			return err
+		}
+		cw := csv.NewWriter(&buf)
+		for _, ticket := range t {
+			cw.Write(ticketRow(ticket, header))
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	if needsNewline(f) {
+		data = append([]byte("\n"), data...)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// csvHeader returns the standard column name of each data file column,
+// locating required columns the way parseCSV does
+func (l *Loader) csvHeader(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	first, err := csv.NewReader(bufio.NewReader(f)).Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	header := make([]string, len(first))
+	for i, h := range first {
+		header[i] = strings.ToLower(strings.TrimSpace(h))
+	}
+	pos, err := l.csvPositions(header)
+	if err != nil {
+		return nil, err
+	}
+	source := make(map[string]string, len(l.columnMap))
+	for name, src := range l.columnMap {
+		source[src] = name
+	}
+	for i, h := range header {
+		if name, ok := source[h]; ok {
+			header[i] = name
+		}
+	}
+	for j, p := range pos {
+		if p < len(header) {
+			header[p] = csvColumns[j]
+		}
+	}
+	return header, nil
+}
+
+// ticketRow renders a ticket as cells for the given standard column names;
+// columns LogLens doesn't know are left empty
+func ticketRow(t analytics.Ticket, header []string) []string {
+	row := make([]string, len(header))
+	for i, h := range header {
+		switch h {
+		case "id":
+			row[i] = strconv.Itoa(t.ID)
+		case "created_at":
+			row[i] = t.CreatedAt.Format(time.RFC3339)
+		case "closed_at":
+			if t.ClosedAt != nil {
+				row[i] = t.ClosedAt.Format(time.RFC3339)
+			}
+		case "category":
+			row[i] = t.Category
+		case "priority":
+			row[i] = t.Priority
+		case "status":
+			row[i] = t.Status
+		case "assignee":
+			row[i] = t.Assignee
+		case "tags":
+			row[i] = strings.Join(t.Tags, TagSeparator)
+		case "reassignment_count":
+			if t.Reassignments != nil {
+				row[i] = strconv.Itoa(*t.Reassignments)
+			}
+		case "reopened_count":
+			if t.Reopens != nil {
+				row[i] = strconv.Itoa(*t.Reopens)
+			}
+		case "first_response_at":
+			if t.FirstResponseAt != nil {
+				row[i] = t.FirstResponseAt.Format(time.RFC3339)
+			}
+		}
+	}
+	return row
+}
+
+// needsNewline reports whether a non-empty file lacks a trailing newline
+func needsNewline(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil || fi.Size() == 0 {
+		return false
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, fi.Size()-1); err != nil && err != io.EOF {
+		return false
+	}
+	return last[0] != '\n'
+}
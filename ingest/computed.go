@@ -0,0 +1,119 @@
+package ingest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// ComputedField is a field derived from each ticket's columns at load
+// time by an expression, such as is_urgent = priority in ("P1", "P2")
+type ComputedField struct {
+	Name string
+	Expr string
+	expr expr
+}
+
+// computedNamePattern keeps computed field names usable as group_by keys
+var computedNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// ticketVars are the columns an expression can read; see fieldVars
+var ticketVars = []string{"id", "created_at", "closed_at", "category", "priority", "status",
+	"assignee", "tags", "reassignment_count", "reopened_count", "first_response_at"}
+
+// ParseComputedFields reads -computed-fields definitions: one
+// "name = expression" per line, blank lines and # comments ignored. An
+// expression may use the ticket columns and the fields defined above it.
+// Names reserved reports, such as the built-in group keys, are refused.
+func ParseComputedFields(text string, reserved func(string) bool) ([]ComputedField, error) {
+	names := make(map[string]bool)
+	for _, v := range ticketVars {
+		names[v] = true
+	}
+	var fields []ComputedField
+	for n, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: want name = expression", n+1)
+		}
+		name := strings.TrimSpace(line[:eq])
+		if !computedNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("line %d: invalid name %q: use lowercase letters, digits and _", n+1, name)
+		}
+		if names[name] || reserved(name) {
+			return nil, fmt.Errorf("line %d: %q is already a field", n+1, name)
+		}
+		src := strings.TrimSpace(line[eq+1:])
+		e, err := parseExpr(src, names)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", n+1, name, err)
+		}
+		fields = append(fields, ComputedField{Name: name, Expr: src, expr: e})
+		names[name] = true
+	}
+	return fields, nil
+}
+
+// ComputeFields sets the computed fields of every ticket, as a load does.
+// Stores don't keep them, so tickets read back from one go through this.
+func (l *Loader) ComputeFields(t []analytics.Ticket) {
+	if len(l.computedFields) == 0 {
+		return
+	}
+	for i := range t {
+		l.computeFields(&t[i])
+	}
+}
+
+// computeFields evaluates the configured fields in order, each seeing the
+// ones before it
+func (l *Loader) computeFields(t *analytics.Ticket) {
+	if len(l.computedFields) == 0 {
+		return
+	}
+	vars := l.fieldVars(*t)
+	t.Fields = make(map[string]string, len(l.computedFields))
+	for _, f := range l.computedFields {
+		v := toString(f.expr.eval(vars))
+		t.Fields[f.Name] = v
+		vars[f.Name] = v
+	}
+}
+
+// fieldVars exposes a ticket's columns to expressions: the ID and counts
+// as numbers (an absent count is ""), tags as a list and times as RFC 3339
+// text in the configured zone ("" while open or not responded to)
+func (l *Loader) fieldVars(t analytics.Ticket) map[string]interface{} {
+	vars := map[string]interface{}{
+		"id":                 float64(t.ID),
+		"created_at":         t.CreatedAt.In(l.location).Format(time.RFC3339),
+		"closed_at":          "",
+		"category":           t.Category,
+		"priority":           t.Priority,
+		"status":             t.Status,
+		"assignee":           t.Assignee,
+		"tags":               append([]string{}, t.Tags...),
+		"reassignment_count": "",
+		"reopened_count":     "",
+		"first_response_at":  "",
+	}
+	if t.ClosedAt != nil {
+		vars["closed_at"] = t.ClosedAt.In(l.location).Format(time.RFC3339)
+	}
+	if t.Reassignments != nil {
+		vars["reassignment_count"] = float64(*t.Reassignments)
+	}
+	if t.Reopens != nil {
+		vars["reopened_count"] = float64(*t.Reopens)
+	}
+	if t.FirstResponseAt != nil {
+		vars["first_response_at"] = t.FirstResponseAt.In(l.location).Format(time.RFC3339)
+	}
+	return vars
+}
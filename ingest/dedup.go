@@ -0,0 +1,88 @@
+package ingest
+
+import (
+	"fmt"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// The -duplicates policies: which copy of a repeated ticket ID a load
+// keeps, or whether it fails
+const (
+	KeepFirst      = "keep-first"
+	KeepLast       = "keep-last"
+	FailDuplicates = "error"
+)
+
+// DuplicatePolicies lists the values Options.Duplicates accepts
+var DuplicatePolicies = []string{KeepFirst, KeepLast, FailDuplicates}
+
+// merger collects tickets by ID under the duplicate policy, counting
+// repeats into stats. A kept repeat replaces the earlier copy in place,
+// so the rest keep their order.
+type merger struct {
+	tickets  []analytics.Ticket
+	index    map[int]int
+	repeated map[int]bool
+	policy   string
+	stats    *LoadStats
+}
+
+func (l *Loader) newMerger(cur []analytics.Ticket, stats *LoadStats) *merger {
+	m := &merger{
+		tickets:  make([]analytics.Ticket, len(cur)),
+		index:    make(map[int]int, len(cur)),
+		repeated: make(map[int]bool),
+		policy:   l.duplicatePolicy,
+		stats:    stats,
+	}
+	copy(m.tickets, cur)
+	for i, t := range m.tickets {
+		m.index[t.ID] = i
+	}
+	return m
+}
+
+// add merges t, failing under FailDuplicates when its ID is already held
+func (m *merger) add(t analytics.Ticket) error {
+	i, ok := m.index[t.ID]
+	if !ok {
+		m.index[t.ID] = len(m.tickets)
+		m.tickets = append(m.tickets, t)
+		return nil
+	}
+	if m.policy == FailDuplicates {
+		return fmt.Errorf("duplicate ticket ID %d (-duplicates=error)", t.ID)
+	}
+	m.stats.Duplicates++
+	m.repeat(t.ID)
+	if m.policy == KeepFirst {
+		return nil
+	}
+	if t.History == nil {
+		t.History = m.tickets[i].History
+	}
+	m.tickets[i] = t
+	return nil
+}
+
+// repeat lists id in the report's duplicate IDs, once
+func (m *merger) repeat(id int) {
+	if !m.repeated[id] {
+		m.repeated[id] = true
+		m.stats.DuplicateIDs = appendCapped(m.stats.DuplicateIDs, id)
+	}
+}
+
+// Merge merges tickets read after cur was loaded, such as rows appended to
+// a data file, into a copy of cur under the -duplicates policy, counting
+// repeated IDs into stats
+func (l *Loader) Merge(cur, add []analytics.Ticket, stats *LoadStats) ([]analytics.Ticket, error) {
+	m := l.newMerger(cur, stats)
+	for _, t := range add {
+		if err := m.add(t); err != nil {
+			return nil, err
+		}
+	}
+	return m.tickets, nil
+}
@@ -0,0 +1,494 @@
+package ingest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The expression language of -computed-fields. Values are strings,
+// numbers, booleans or lists (tags); operators and functions convert
+// between them as a spreadsheet would, so `priority in ("P1", "P2")`,
+// `reopened_count > 0` and `substr(category, 0, 2)` all just work.
+//
+//	expr    = or
+//	or      = and {"or" and}
+//	and     = not {"and" not}
+//	not     = "not" not | compare
+//	compare = value [("==" | "!=" | "<" | "<=" | ">" | ">=") value
+//	                | ["not"] "in" (list | value)]
+//	list    = "(" expr {"," expr} ")"
+//	value   = string | number | "true" | "false" | name | name "(" [expr {"," expr}] ")" | "(" expr ")"
+
+// expr is a parsed expression, evaluated against one ticket's columns
+type expr interface {
+	eval(vars map[string]interface{}) interface{}
+}
+
+type (
+	literal  struct{ v interface{} }
+	variable struct{ name string }
+	call     struct {
+		fn   exprFunc
+		args []expr
+	}
+	unary  struct{ x expr } // not
+	binary struct {
+		op   string
+		l, r expr
+	}
+	membership struct {
+		x      expr
+		list   []expr // a literal list, or nil to search the value of in
+		in     expr
+		negate bool
+	}
+)
+
+func (e literal) eval(map[string]interface{}) interface{}    { return e.v }
+func (e variable) eval(v map[string]interface{}) interface{} { return v[e.name] }
+func (e unary) eval(v map[string]interface{}) interface{}    { return !truthy(e.x.eval(v)) }
+
+func (e call) eval(v map[string]interface{}) interface{} {
+	args := make([]interface{}, len(e.args))
+	for i, a := range e.args {
+		args[i] = a.eval(v)
+	}
+	return e.fn.call(args)
+}
+
+func (e binary) eval(v map[string]interface{}) interface{} {
+	switch e.op {
+	case "and":
+		return truthy(e.l.eval(v)) && truthy(e.r.eval(v))
+	case "or":
+		return truthy(e.l.eval(v)) || truthy(e.r.eval(v))
+	}
+	l, r := e.l.eval(v), e.r.eval(v)
+	switch e.op {
+	case "==":
+		return equal(l, r)
+	case "!=":
+		return !equal(l, r)
+	}
+	c := compare(l, r)
+	switch e.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+func (e membership) eval(v map[string]interface{}) interface{} {
+	x := e.x.eval(v)
+	var items []interface{}
+	if e.list != nil {
+		for _, item := range e.list {
+			items = append(items, item.eval(v))
+		}
+	} else if list, ok := e.in.eval(v).([]string); ok {
+		for _, item := range list {
+			items = append(items, item)
+		}
+	} else {
+		// x in "text" looks for a substring
+		return strings.Contains(toString(e.in.eval(v)), toString(x)) != e.negate
+	}
+	for _, item := range items {
+		if equal(x, item) {
+			return !e.negate
+		}
+	}
+	return e.negate
+}
+
+// toString renders a value the way a computed field stores it
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []string:
+		return strings.Join(v, TagSeparator)
+	}
+	return ""
+}
+
+// toNumber converts v, reporting whether it is a number
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// truthy is false for false, "", "false", 0 and an empty list
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != "" && v != "false"
+	case []string:
+		return len(v) > 0
+	}
+	return false
+}
+
+// equal compares numerically when both sides are numbers, else as text
+func equal(a, b interface{}) bool {
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			return x == y
+		}
+	}
+	return toString(a) == toString(b)
+}
+
+// compare orders numerically when both sides are numbers, else as text
+func compare(a, b interface{}) int {
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(toString(a), toString(b))
+}
+
+// exprFunc is a function expressions may call
+type exprFunc struct {
+	minArgs, maxArgs int // maxArgs < 0 is unlimited
+	call             func(args []interface{}) interface{}
+}
+
+var exprFuncs = map[string]exprFunc{
+	"lower": {1, 1, func(a []interface{}) interface{} { return strings.ToLower(toString(a[0])) }},
+	"upper": {1, 1, func(a []interface{}) interface{} { return strings.ToUpper(toString(a[0])) }},
+	"trim":  {1, 1, func(a []interface{}) interface{} { return strings.TrimSpace(toString(a[0])) }},
+	"len": {1, 1, func(a []interface{}) interface{} {
+		if list, ok := a[0].([]string); ok {
+			return float64(len(list))
+		}
+		return float64(len([]rune(toString(a[0]))))
+	}},
+	// substr(s, start[, length]) counts characters from 0; out-of-range
+	// bounds are clamped
+	"substr": {2, 3, func(a []interface{}) interface{} {
+		s := []rune(toString(a[0]))
+		start, _ := toNumber(a[1])
+		from := clamp(int(start), 0, len(s))
+		to := len(s)
+		if len(a) == 3 {
+			n, _ := toNumber(a[2])
+			to = clamp(from+int(n), from, len(s))
+		}
+		return string(s[from:to])
+	}},
+	"contains":    {2, 2, func(a []interface{}) interface{} { return strings.Contains(toString(a[0]), toString(a[1])) }},
+	"starts_with": {2, 2, func(a []interface{}) interface{} { return strings.HasPrefix(toString(a[0]), toString(a[1])) }},
+	"ends_with":   {2, 2, func(a []interface{}) interface{} { return strings.HasSuffix(toString(a[0]), toString(a[1])) }},
+	"concat": {1, -1, func(a []interface{}) interface{} {
+		var b strings.Builder
+		for _, v := range a {
+			b.WriteString(toString(v))
+		}
+		return b.String()
+	}},
+	// if(condition, then, else)
+	"if": {3, 3, func(a []interface{}) interface{} {
+		if truthy(a[0]) {
+			return a[1]
+		}
+		return a[2]
+	}},
+	// coalesce returns its first non-empty argument
+	"coalesce": {1, -1, func(a []interface{}) interface{} {
+		for _, v := range a {
+			if toString(v) != "" {
+				return v
+			}
+		}
+		return ""
+	}},
+}
+
+func clamp(n, lo, hi int) int {
+	if n < lo {
+		return lo
+	}
+	if n > hi {
+		return hi
+	}
+	return n
+}
+
+// token is one lexeme: kind is 's' (string), 'n' (number), 'i' (name or
+// keyword) or the operator itself
+type token struct {
+	kind string
+	text string
+	pos  int
+}
+
+func tokenize(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != src[i] {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i+1)
+			}
+			text := src[i : j+1]
+			if c == '\'' {
+				text = `"` + strings.ReplaceAll(src[i+1:j], `"`, `\"`) + `"`
+			}
+			s, err := strconv.Unquote(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d: %v", i+1, err)
+			}
+			toks = append(toks, token{"s", s, i})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '.' || c == '-' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			j := i + 1
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{"n", src[i:j], i})
+			i = j
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(src) && isNameByte(src[j]) {
+				j++
+			}
+			toks = append(toks, token{"i", strings.ToLower(src[i:j]), i})
+			i = j
+		default:
+			op := src[i : i+1]
+			if i+1 < len(src) && compareOps[src[i:i+2]] {
+				op = src[i : i+2]
+			}
+			i += len(op)
+			switch {
+			case op == "=":
+				op = "=="
+			case !compareOps[op] && op != "(" && op != ")" && op != ",":
+				return nil, fmt.Errorf("unexpected %q at %d", op, i)
+			}
+			toks = append(toks, token{op, op, i - 1})
+		}
+	}
+	return toks, nil
+}
+
+// compareOps are the comparison operators
+var compareOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// exprParser is a recursive-descent parser over tokens. names are the
+// variables an expression may use.
+type exprParser struct {
+	toks  []token
+	pos   int
+	names map[string]bool
+}
+
+// parseExpr parses src, which may refer to the given variable names
+func parseExpr(src string, names map[string]bool) (expr, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{toks: toks, names: names}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q at %d", p.toks[p.pos].text, p.toks[p.pos].pos+1)
+	}
+	return e, nil
+}
+
+func (p *exprParser) peek() token {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return token{}
+}
+
+// accept consumes the next token if it is the keyword or operator want
+func (p *exprParser) accept(want string) bool {
+	t := p.peek()
+	if t.text == want && (t.kind == "i" || t.kind == want) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(want string) error {
+	if !p.accept(want) {
+		if p.pos >= len(p.toks) {
+			return fmt.Errorf("expected %q at end", want)
+		}
+		t := p.peek()
+		return fmt.Errorf("expected %q at %d, got %q", want, t.pos+1, t.text)
+	}
+	return nil
+}
+
+func (p *exprParser) or() (expr, error) {
+	l, err := p.and()
+	for err == nil && p.accept("or") {
+		var r expr
+		if r, err = p.and(); err == nil {
+			l = binary{"or", l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *exprParser) and() (expr, error) {
+	l, err := p.not()
+	for err == nil && p.accept("and") {
+		var r expr
+		if r, err = p.not(); err == nil {
+			l = binary{"and", l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *exprParser) not() (expr, error) {
+	if p.accept("not") {
+		x, err := p.not()
+		return unary{x}, err
+	}
+	return p.compare()
+}
+
+func (p *exprParser) compare() (expr, error) {
+	l, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); {
+	case compareOps[op.kind]:
+		p.pos++
+		r, err := p.value()
+		return binary{op.kind, l, r}, err
+	case op.kind == "i" && (op.text == "in" || op.text == "not"):
+		m := membership{x: l, negate: p.accept("not")}
+		if err := p.expect("in"); err != nil {
+			return nil, err
+		}
+		if p.accept("(") {
+			for {
+				item, err := p.or()
+				if err != nil {
+					return nil, err
+				}
+				m.list = append(m.list, item)
+				if !p.accept(",") {
+					break
+				}
+			}
+			return m, p.expect(")")
+		}
+		m.in, err = p.value()
+		return m, err
+	}
+	return l, nil
+}
+
+func (p *exprParser) value() (expr, error) {
+	if p.pos >= len(p.toks) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	t := p.toks[p.pos]
+	p.pos++
+	switch t.kind {
+	case "s":
+		return literal{t.text}, nil
+	case "n":
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos+1)
+		}
+		return literal{n}, nil
+	case "(":
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	case "i":
+		switch t.text {
+		case "true", "false":
+			return literal{t.text == "true"}, nil
+		}
+		if !p.accept("(") {
+			if !p.names[t.text] {
+				return nil, fmt.Errorf("unknown field %q at %d", t.text, t.pos+1)
+			}
+			return variable{t.text}, nil
+		}
+		fn, ok := exprFuncs[t.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown function %q at %d", t.text, t.pos+1)
+		}
+		c := call{fn: fn}
+		if !p.accept(")") {
+			for {
+				arg, err := p.or()
+				if err != nil {
+					return nil, err
+				}
+				c.args = append(c.args, arg)
+				if !p.accept(",") {
+					break
+				}
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+		}
+		if len(c.args) < fn.minArgs || fn.maxArgs >= 0 && len(c.args) > fn.maxArgs {
+			return nil, fmt.Errorf("%s at %d: wrong number of arguments (%d)", t.text, t.pos+1, len(c.args))
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos+1)
+}
@@ -0,0 +1,201 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// FileStats is the parse outcome of one file matched by a -data glob
+type FileStats struct {
+	Path     string `json:"path"`
+	Rows     int    `json:"rows"`
+	Loaded   int    `json:"loaded"`
+	Skipped  int    `json:"skipped"`
+	Rejected int    `json:"rejected"`
+	Flagged  int    `json:"flagged"`
+	Excluded int    `json:"excluded"`
+	Purged   int    `json:"purged"`
+	// Duplicates counts IDs repeated within the file; see LoadStats
+	Duplicates int `json:"duplicates"`
+}
+
+// IsGlob reports whether a -data path is a pattern rather than one file
+func IsGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// DataFiles expands a -data pattern into the files to load, in name order so that
+// exports named by date merge oldest first
+func DataFiles(pattern string) ([]string, error) {
+	if !IsGlob(pattern) {
+		return []string{pattern}, nil
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -data pattern %q: %v", pattern, err)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// ParseFiles parses every file and merges them by ticket ID. A ticket
+// seen again in a later file replaces the earlier copy in place, so the
+// newest export wins without reordering the rest.
+func (l *Loader) ParseFiles(paths []string, format string) ([]analytics.Ticket, LoadStats, error) {
+	merged, total, _, err := l.ParseFilesFrom(paths, format, nil)
+	return merged, total, err
+}
+
+// Offset is how far a load read one data file
+type Offset struct {
+	Pos  int64 // just past the last row read
+	info os.FileInfo
+}
+
+// Offsets maps each file a load read to its Offset, so the next
+// incremental load can resume where it stopped
+type Offsets map[string]Offset
+
+// ErrRewritten means a data file shrank, was replaced or went away since
+// its offsets were taken, so only a full load can tell what it holds now
+var ErrRewritten = errors.New("data file rewritten since the last load")
+
+// ParseFilesFrom is ParseFiles reading only what was appended since from
+// was taken: each known file from its offset on, and new files whole.
+// Those reads stop after the last complete line, so a row still being
+// written is left for the next load, and their issues number lines from
+// the offset. A nil from reads every file whole. The returned Offsets
+// cover every path, for the next call.
+func (l *Loader) ParseFilesFrom(paths []string, format string, from Offsets) ([]analytics.Ticket, LoadStats, Offsets, error) {
+	total := LoadStats{Appended: from != nil, DuplicatePolicy: l.duplicatePolicy}
+	merged := l.newMerger(nil, &total)
+	offsets := make(Offsets, len(paths))
+	for path := range from {
+		if !containsExact(paths, path) {
+			return nil, total, nil, ErrRewritten
+		}
+	}
+	for _, path := range paths {
+		parsed, stats, off, err := l.parseFileFrom(path, format, from)
+		if err == ErrRewritten {
+			return nil, total, nil, err
+		}
+		if err != nil {
+			return nil, total, nil, fmt.Errorf("%s: %v", path, err)
+		}
+		offsets[path] = off
+		log.Printf("Parsed %s: %d rows, %d loaded, %d skipped, %d rejected",
+			path, stats.Rows, stats.Loaded, stats.Skipped, stats.Rejected)
+
+		for _, t := range parsed {
+			if err := merged.add(t); err != nil {
+				return nil, total, nil, fmt.Errorf("%s: %v", path, err)
+			}
+		}
+		for _, id := range stats.DuplicateIDs {
+			merged.repeat(id)
+		}
+		for _, issue := range stats.Issues {
+			if len(total.Issues) < maxReportedIssues {
+				issue.File = path
+				total.Issues = append(total.Issues, issue)
+			}
+		}
+		total.Rows += stats.Rows
+		total.Skipped += stats.Skipped
+		total.Purged += stats.Purged
+		total.Excluded += stats.Excluded
+		total.Rejected += stats.Rejected
+		total.Flagged += stats.Flagged
+		total.Duplicates += stats.Duplicates
+		total.LoadedAt = stats.LoadedAt
+		total.Files = append(total.Files, FileStats{
+			Path:       path,
+			Rows:       stats.Rows,
+			Loaded:     stats.Loaded,
+			Skipped:    stats.Skipped,
+			Rejected:   stats.Rejected,
+			Flagged:    stats.Flagged,
+			Excluded:   stats.Excluded,
+			Purged:     stats.Purged,
+			Duplicates: stats.Duplicates,
+		})
+	}
+	total.Loaded = len(merged.tickets)
+	return merged.tickets, total, offsets, nil
+}
+
+// parseFileFrom parses one file for ParseFilesFrom. A CSV read from an
+// offset gets the file's header line put back in front.
+func (l *Loader) parseFileFrom(path, format string, from Offsets) ([]analytics.Ticket, LoadStats, Offset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, LoadStats{}, Offset{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, LoadStats{}, Offset{}, err
+	}
+	var start int64
+	end := fi.Size()
+	if prev, ok := from[path]; ok {
+		if !os.SameFile(prev.info, fi) || end < prev.Pos {
+			return nil, LoadStats{}, Offset{}, ErrRewritten
+		}
+		start = prev.Pos
+	}
+	if from != nil {
+		if end, err = lastLineEnd(f, start, end); err != nil {
+			return nil, LoadStats{}, Offset{}, err
+		}
+	}
+
+	var in io.Reader = io.NewSectionReader(f, start, end-start)
+	if start > 0 && format != "jsonl" {
+		header, err := bufio.NewReader(io.NewSectionReader(f, 0, start)).ReadBytes('\n')
+		if err != nil {
+			return nil, LoadStats{}, Offset{}, fmt.Errorf("reading header: %v", err)
+		}
+		in = io.MultiReader(bytes.NewReader(header), in)
+	}
+	parsed, stats, err := l.Parse(in, format)
+	return parsed, stats, Offset{Pos: end, info: fi}, err
+}
+
+// lastLineEnd returns the offset just past the last newline in f between
+// start and end, or start when there is none
+func lastLineEnd(f *os.File, start, end int64) (int64, error) {
+	buf := make([]byte, 64*1024)
+	for pos := end; pos > start; {
+		n := int64(len(buf))
+		if pos-start < n {
+			n = pos - start
+		}
+		pos -= n
+		if _, err := f.ReadAt(buf[:n], pos); err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return pos + int64(i) + 1, nil
+		}
+	}
+	return start, nil
+}
+
+func appendCapped(ids []int, id int) []int {
+	if len(ids) < maxReportedIssues {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,114 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// historyColumns maps the accepted -status-history header names to the
+// column they fill
+var historyColumns = map[string]string{
+	"ticket_id":  "ticket_id",
+	"id":         "ticket_id",
+	"status":     "status",
+	"timestamp":  "timestamp",
+	"changed_at": "timestamp",
+}
+
+// parseStatusHistory reads a CSV of ticket_id, status, timestamp rows in
+// any column order. Changes come back per ticket in time order; rows that
+// can't be parsed are logged and counted in skipped.
+func (l *Loader) parseStatusHistory(r io.Reader) (history map[int][]analytics.StatusChange, changes, skipped int, err error) {
+	cr := csv.NewReader(bufio.NewReader(r))
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("reading header: %v", err)
+	}
+	pos := map[string]int{}
+	for i, h := range header {
+		if col, ok := historyColumns[strings.ToLower(strings.TrimSpace(h))]; ok {
+			if _, dup := pos[col]; !dup {
+				pos[col] = i
+			}
+		}
+	}
+	for _, col := range []string{"ticket_id", "status", "timestamp"} {
+		if _, ok := pos[col]; !ok {
+			return nil, 0, 0, fmt.Errorf("missing required column %q", col)
+		}
+	}
+
+	history = make(map[int][]analytics.StatusChange)
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		cell := func(col string) string {
+			if p := pos[col]; p < len(row) {
+				return strings.TrimSpace(row[p])
+			}
+			return ""
+		}
+		id, err := strconv.Atoi(cell("ticket_id"))
+		if err != nil || id <= 0 {
+			log.Printf("Skipping history row %d: invalid ticket_id %q", line, cell("ticket_id"))
+			skipped++
+			continue
+		}
+		status := cell("status")
+		if status == "" {
+			log.Printf("Skipping history row %d: empty status", line)
+			skipped++
+			continue
+		}
+		at, err := l.ParseTimestamp(cell("timestamp"))
+		if err != nil {
+			log.Printf("Skipping history row %d: invalid timestamp %q", line, cell("timestamp"))
+			skipped++
+			continue
+		}
+		history[id] = append(history[id], analytics.StatusChange{Status: status, At: at})
+		changes++
+	}
+	for _, h := range history {
+		sort.SliceStable(h, func(i, j int) bool { return h[i].At.Before(h[j].At) })
+	}
+	return history, changes, skipped, nil
+}
+
+// AttachHistory reads the -status-history file and sets each loaded
+// ticket's History; changes for tickets that aren't loaded are ignored
+func (l *Loader) AttachHistory(t []analytics.Ticket, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	history, changes, skipped, err := l.parseStatusHistory(f)
+	if err != nil {
+		return fmt.Errorf("status history %s: %v", path, err)
+	}
+	matched := 0
+	for i := range t {
+		if h, ok := history[t[i].ID]; ok {
+			t[i].History = h
+			matched++
+		}
+	}
+	log.Printf("Loaded status history for %d tickets from %s (%d changes, %d skipped)", matched, path, changes, skipped)
+	return nil
+}
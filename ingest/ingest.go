@@ -0,0 +1,577 @@
+// Package ingest parses ticket exports (CSV and JSON Lines) into
+// analytics.Tickets, applying LogLens's column mapping, validation,
+// exclusion and retention rules and counting what it kept and dropped.
+package ingest
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// millisLayout is the timestamp format of our newer log exports
+const millisLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// Options are the load-time rules; the server sets them from the flags
+// named alongside
+type Options struct {
+	// Location is the zone timestamps without an offset are read in, and
+	// that every parsed time is converted to (-timezone)
+	Location *time.Location
+	// TimeLayouts are Go time layouts tried before the built-in ones
+	// (-time-layout)
+	TimeLayouts []string
+	// Columns maps standard column names to source columns (-columns);
+	// see ParseColumnMap
+	Columns map[string]string
+	// OpenSentinels are closed_at values that mean the ticket is still
+	// open (-open-sentinels)
+	OpenSentinels []string
+	// ValidPriorities and ValidStatuses list the allowed values; empty
+	// allows any (-valid-priorities, -valid-statuses)
+	ValidPriorities, ValidStatuses []string
+	// Strict rejects rows that fail validation instead of keeping and
+	// flagging them (-validation-mode=strict)
+	Strict bool
+	// ExcludedIDs are dropped at load time (-exclude-ids)
+	ExcludedIDs map[int]bool
+	// RetainDays drops tickets created more than this many days before
+	// AsOf; 0 keeps all (-retain-days)
+	RetainDays int
+	// AsOf is the reference time for RetainDays; zero means the wall
+	// clock (-as-of)
+	AsOf time.Time
+	// Duplicates is the policy for a ticket ID read more than once:
+	// KeepFirst, KeepLast (the default) or FailDuplicates (-duplicates)
+	Duplicates string
+	// Computed are the fields derived for every ticket (-computed-fields);
+	// see ParseComputedFields
+	Computed []ComputedField
+}
+
+// Loader parses ticket data under one set of Options. It is safe for
+// concurrent use.
+type Loader struct {
+	location         *time.Location
+	timeLayouts      []string // the layouts ParseTimestamp tries, in order
+	columnMap        map[string]string
+	openSentinels    []string
+	validPriorities  []string
+	validStatuses    []string
+	strictValidation bool
+	excludedIDs      map[int]bool
+	retainDays       int
+	asOfTime         time.Time
+	duplicatePolicy  string
+	computedFields   []ComputedField
+}
+
+// builtinLayouts are tried in order after Options.TimeLayouts. Layouts
+// without a zone are read in Options.Location.
+var builtinLayouts = []string{
+	analytics.DateLayout,
+	millisLayout,
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+}
+
+// New returns a Loader applying o
+func New(o Options) *Loader {
+	l := &Loader{
+		location:         o.Location,
+		timeLayouts:      append(append([]string{}, o.TimeLayouts...), builtinLayouts...),
+		columnMap:        o.Columns,
+		openSentinels:    o.OpenSentinels,
+		validPriorities:  o.ValidPriorities,
+		validStatuses:    o.ValidStatuses,
+		strictValidation: o.Strict,
+		excludedIDs:      o.ExcludedIDs,
+		retainDays:       o.RetainDays,
+		asOfTime:         o.AsOf,
+		duplicatePolicy:  o.Duplicates,
+		computedFields:   o.Computed,
+	}
+	if l.location == nil {
+		l.location = time.UTC
+	}
+	if l.duplicatePolicy == "" {
+		l.duplicatePolicy = KeepLast
+	}
+	return l
+}
+
+// LoadStats records the outcome of a load
+type LoadStats struct {
+	Rows     int       `json:"rows"`
+	Loaded   int       `json:"loaded"`
+	Skipped  int       `json:"skipped"`
+	Purged   int       `json:"purged"`
+	Excluded int       `json:"excluded"` // IDs listed in -exclude-ids/-exclude-ids-file
+	Rejected int       `json:"rejected"` // failed validation under -validation-mode=strict
+	Flagged  int       `json:"flagged"`  // failed validation but kept
+	LoadedAt time.Time `json:"loaded_at"`
+
+	// Rows whose ticket ID was already read, in the same file, an
+	// earlier file of a -data glob or an earlier load; -duplicates picks
+	// the copy kept
+	Duplicates      int    `json:"duplicates"`
+	DuplicatePolicy string `json:"duplicate_policy"`
+	// With a -data glob, each file's own counts
+	Files []FileStats `json:"files,omitempty"`
+
+	// Appended is set when only rows appended since the previous load
+	// were read; see ParseFilesFrom
+	Appended bool `json:"appended"`
+
+	// The first maxReportedIssues dropped rows and repeated IDs, for the
+	// reload report; the counts above stay exact
+	Issues       []RowIssue `json:"issues"`
+	DuplicateIDs []int      `json:"duplicate_ids"`
+}
+
+// RowIssue is an input row dropped by a load and why
+type RowIssue struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line"`
+	Outcome string `json:"outcome"` // skipped or rejected
+	Reason  string `json:"reason"`
+}
+
+// maxReportedIssues caps the rows and IDs a load report lists, so a file
+// with a systematic problem doesn't produce a report as big as itself
+const maxReportedIssues = 100
+
+// isOpenSentinel reports whether a closed_at value marks an open ticket
+func (l *Loader) isOpenSentinel(v string) bool {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return true
+	}
+	for _, s := range l.openSentinels {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse parses ticket data in the given format ("csv" or "jsonl"),
+// applying the load-time validation and retention rules. It changes
+// nothing outside its result, so it also backs /api/analyze.
+func (l *Loader) Parse(in io.Reader, format string) ([]analytics.Ticket, LoadStats, error) {
+	b := ticketBuilder{l: l}
+	var err error
+	if format == "jsonl" {
+		err = l.parseJSONL(in, &b)
+	} else {
+		err = l.parseCSV(in, &b)
+	}
+	if err == nil {
+		err = b.err
+	}
+	if err != nil {
+		return nil, b.stats, err
+	}
+	parsed, stats := b.finish()
+	return parsed, stats, nil
+}
+
+// csvColumns are the required CSV columns, matched by position
+var csvColumns = []string{"id", "created_at", "closed_at", "category", "priority", "status"}
+
+// parseCSV streams CSV rows to b one at a time, so memory use is bounded by
+// the parsed tickets rather than the raw file. Required columns are
+// positional; anything else is keyed by its header name. Rows may have
+// differing field counts; those missing required columns are skipped.
+func (l *Loader) parseCSV(in io.Reader, b *ticketBuilder) error {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	first, err := r.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	header := make([]string, len(first))
+	for i, h := range first {
+		header[i] = strings.ToLower(strings.TrimSpace(h))
+	}
+	pos, err := l.csvPositions(header)
+	if err != nil {
+		return err
+	}
+	minFields := 0
+	for _, p := range pos {
+		if p+1 > minFields {
+			minFields = p + 1
+		}
+	}
+
+	for line := 2; ; line++ {
+		row, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(row) < minFields {
+			b.skip(line, fmt.Sprintf("%d fields, want at least %d", len(row), minFields))
+			continue
+		}
+		rec := make(Record, len(row))
+		for j, v := range row {
+			if j < len(header) {
+				rec[header[j]] = v
+			}
+		}
+		for j, name := range csvColumns {
+			rec[name] = row[pos[j]]
+		}
+		applyColumnMap(rec, l.columnMap, false)
+		if b.add(rec, line); b.err != nil {
+			return b.err
+		}
+	}
+}
+
+// csvPositions finds each required column: by header name when -columns
+// maps it, otherwise by its standard position
+func (l *Loader) csvPositions(header []string) ([]int, error) {
+	pos := make([]int, len(csvColumns))
+	for j, name := range csvColumns {
+		pos[j] = j
+		src, ok := l.columnMap[name]
+		if !ok {
+			continue
+		}
+		found := false
+		for i, h := range header {
+			if h == src {
+				pos[j], found = i, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("-columns maps %s to %q, which is not in the header", name, src)
+		}
+	}
+	return pos, nil
+}
+
+// applyColumnMap copies mapped source columns onto their standard names.
+// Required CSV columns are already placed by csvPositions, so only JSON
+// Lines records pass required=true.
+func applyColumnMap(rec Record, m map[string]string, required bool) {
+	for name, src := range m {
+		if !required && containsExact(csvColumns, name) {
+			continue
+		}
+		if v, ok := rec[src]; ok {
+			rec[name] = v
+		}
+	}
+}
+
+// knownColumns are the names -columns may map
+var knownColumns = append(append([]string{}, csvColumns...), "reassignment_count", "reopened_count", "first_response_at", "assignee", "tags")
+
+// ParseColumnMap parses "created_at=opened_on,status=state" into standard
+// column name -> lower-cased source column
+func ParseColumnMap(spec string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		eq := strings.Index(part, "=")
+		if eq <= 0 || eq == len(part)-1 {
+			return nil, fmt.Errorf("invalid mapping %q, want column=source", part)
+		}
+		name := strings.ToLower(strings.TrimSpace(part[:eq]))
+		if !containsExact(knownColumns, name) {
+			return nil, fmt.Errorf("unknown column %q in %q; want one of %s", name, part, strings.Join(knownColumns, ", "))
+		}
+		m[name] = strings.ToLower(strings.TrimSpace(part[eq+1:]))
+	}
+	return m, nil
+}
+
+// Record is one input row, cells keyed by lower-cased column name
+type Record map[string]string
+
+// optional returns the trimmed value of a column, if present and non-empty
+func (r Record) optional(name string) (string, bool) {
+	v := strings.TrimSpace(r[name])
+	return v, v != ""
+}
+
+// ticketBuilder turns records from any input format into tickets through
+// one validation path, counting outcomes in stats. Under -duplicates=error
+// a repeated ID stops the build with err.
+type ticketBuilder struct {
+	l      *Loader
+	merged *merger
+	stats  LoadStats
+	err    error
+}
+
+// progressRows is how often a long load logs how far it has got
+const progressRows = 100000
+
+// skip counts a row too malformed to read
+func (b *ticketBuilder) skip(line int, reason string) {
+	b.countRow()
+	b.drop(line, "skipped", reason)
+}
+
+// drop logs and reports a row that won't become a ticket
+func (b *ticketBuilder) drop(line int, outcome, reason string) {
+	log.Printf("Skipping row %d: %s", line, reason)
+	if outcome == "rejected" {
+		b.stats.Rejected++
+	} else {
+		b.stats.Skipped++
+	}
+	if len(b.stats.Issues) < maxReportedIssues {
+		b.stats.Issues = append(b.stats.Issues, RowIssue{Line: line, Outcome: outcome, Reason: reason})
+	}
+}
+
+func (b *ticketBuilder) countRow() {
+	b.stats.Rows++
+	if b.stats.Rows%progressRows == 0 {
+		log.Printf("Parsed %d rows...", b.stats.Rows)
+	}
+}
+
+// add converts rec (from input line line) into a ticket, or counts why it
+// was dropped
+func (b *ticketBuilder) add(rec Record, line int) {
+	b.countRow()
+	id, err := strconv.Atoi(strings.TrimSpace(rec["id"]))
+	if err != nil {
+		// Tickets merge by ID, so rows without one would collapse into one
+		b.drop(line, "skipped", "missing or invalid id: "+rec["id"])
+		return
+	}
+	if b.l.excludedIDs[id] {
+		b.stats.Excluded++
+		return
+	}
+	createdAt, err := b.l.ParseTimestamp(rec["created_at"])
+	if err != nil {
+		b.drop(line, "skipped", "invalid created_at: "+rec["created_at"])
+		return
+	}
+
+	var closedAt *time.Time
+	if !b.l.isOpenSentinel(rec["closed_at"]) {
+		t, err := b.l.ParseTimestamp(rec["closed_at"])
+		if err == nil {
+			closedAt = &t
+		} else {
+			log.Printf("Row %d: invalid closed_at %q, treating as open", line, rec["closed_at"])
+		}
+	}
+
+	ticket := analytics.Ticket{
+		ID:        id,
+		CreatedAt: createdAt,
+		ClosedAt:  closedAt,
+		Category:  rec["category"],
+		Priority:  rec["priority"],
+		Status:    rec["status"],
+	}
+	if problem := b.l.validateTicket(ticket); problem != "" {
+		if b.l.strictValidation {
+			b.drop(line, "rejected", problem)
+			return
+		}
+		log.Printf("Row %d: %s", line, problem)
+		b.stats.Flagged++
+	}
+	ticket.Reassignments = optionalCount(rec, "reassignment_count", line)
+	ticket.Reopens = optionalCount(rec, "reopened_count", line)
+	ticket.FirstResponseAt = b.l.optionalTime(rec, "first_response_at", createdAt, line)
+	ticket.Assignee, _ = rec.optional("assignee")
+	if v, ok := rec.optional("tags"); ok {
+		ticket.Tags = ParseTags(v)
+	}
+	b.l.computeFields(&ticket)
+	if b.merged == nil {
+		b.merged = b.l.newMerger(nil, &b.stats)
+	}
+	if err := b.merged.add(ticket); err != nil {
+		b.err = fmt.Errorf("line %d: %v", line, err)
+	}
+}
+
+// finish applies retention and returns the tickets with final stats
+func (b *ticketBuilder) finish() ([]analytics.Ticket, LoadStats) {
+	var parsed []analytics.Ticket
+	if b.merged != nil {
+		parsed = b.merged.tickets
+	}
+	if b.l.retainDays > 0 {
+		now := b.l.asOfTime
+		if now.IsZero() {
+			now = time.Now()
+		}
+		parsed, b.stats.Purged = PurgeOlderThan(parsed, now.AddDate(0, 0, -b.l.retainDays))
+	}
+	b.stats.Loaded = len(parsed)
+	b.stats.DuplicatePolicy = b.l.duplicatePolicy
+	b.stats.LoadedAt = time.Now()
+	return parsed, b.stats
+}
+
+// validateTicket checks a ticket against -valid-priorities and
+// -valid-statuses, returning a description of the first violation
+func (l *Loader) validateTicket(t analytics.Ticket) string {
+	if len(l.validPriorities) > 0 && !containsExact(l.validPriorities, t.Priority) {
+		return fmt.Sprintf("priority %q not in -valid-priorities", t.Priority)
+	}
+	if len(l.validStatuses) > 0 && !containsExact(l.validStatuses, t.Status) {
+		return fmt.Sprintf("status %q not in -valid-statuses", t.Status)
+	}
+	return ""
+}
+
+// PurgeOlderThan drops tickets created before cutoff, reusing t's backing array
+func PurgeOlderThan(t []analytics.Ticket, cutoff time.Time) ([]analytics.Ticket, int) {
+	kept := t[:0]
+	for _, ticket := range t {
+		if !ticket.CreatedAt.Before(cutoff) {
+			kept = append(kept, ticket)
+		}
+	}
+	return kept, len(t) - len(kept)
+}
+
+// ParseTimestamp parses a date or timestamp in any of timeLayouts. Values
+// without an offset are read in the configured zone, and the result is
+// always converted to it so day bucketing stays on local days.
+func (l *Loader) ParseTimestamp(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	var err error
+	for _, layout := range l.timeLayouts {
+		var t time.Time
+		if t, err = time.ParseInLocation(layout, v, l.location); err == nil {
+			return t.In(l.location), nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// TagSeparator separates the values of the tags column
+const TagSeparator = ";"
+
+// ParseTags splits a tags cell into lower-cased tags, so "VPN" and "vpn"
+// count as one, dropping empty entries and repeats
+func ParseTags(v string) []string {
+	var tags []string
+	for _, tag := range strings.Split(v, TagSeparator) {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && !containsExact(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// optionalCount parses a non-negative integer column, logging and ignoring
+// invalid values
+func optionalCount(rec Record, name string, line int) *int {
+	v, ok := rec.optional(name)
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Printf("Row %d: invalid %s %q, ignoring", line, name, v)
+		return nil
+	}
+	return &n
+}
+
+// optionalTime parses an optional timestamp column, ignoring (with a log
+// line) one that is invalid or earlier than created
+func (l *Loader) optionalTime(rec Record, name string, created time.Time, line int) *time.Time {
+	v, ok := rec.optional(name)
+	if !ok {
+		return nil
+	}
+	t, err := l.ParseTimestamp(v)
+	if err != nil {
+		log.Printf("Row %d: invalid %s %q, ignoring", line, name, v)
+		return nil
+	}
+	if t.Before(created) {
+		log.Printf("Row %d: %s %q is before created_at, ignoring", line, name, v)
+		return nil
+	}
+	return &t
+}
+
+// ParseRecords builds tickets from connector records, applying the same
+// validation, retention and duplicate rules as a file load
+func (l *Loader) ParseRecords(recs []Record) ([]analytics.Ticket, LoadStats, error) {
+	b := ticketBuilder{l: l}
+	for i, rec := range recs {
+		if b.add(rec, i+1); b.err != nil {
+			return nil, b.stats, b.err
+		}
+	}
+	parsed, stats := b.finish()
+	return parsed, stats, nil
+}
+
+func containsExact(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseObjects builds tickets from decoded JSON objects, as pushed to
+// POST /api/tickets: the same keys and validation as JSON Lines records,
+// except that each must carry a positive id
+func (l *Loader) ParseObjects(objs []interface{}) ([]analytics.Ticket, LoadStats, error) {
+	b := ticketBuilder{l: l}
+	for i, o := range objs {
+		obj, ok := o.(map[string]interface{})
+		if !ok {
+			b.skip(i+1, "not a JSON object")
+			continue
+		}
+		rec := make(Record, len(obj))
+		for k, v := range obj {
+			rec[strings.ToLower(strings.TrimSpace(k))] = jsonCell(v)
+		}
+		applyColumnMap(rec, l.columnMap, true)
+		if id, err := strconv.Atoi(strings.TrimSpace(rec["id"])); err != nil || id <= 0 {
+			b.countRow()
+			b.drop(i+1, "skipped", "missing or invalid id: "+rec["id"])
+			continue
+		}
+		if b.add(rec, i+1); b.err != nil {
+			return nil, b.stats, b.err
+		}
+	}
+	parsed, stats := b.finish()
+	return parsed, stats, nil
+}
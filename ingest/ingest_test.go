@@ -0,0 +1,42 @@
+package ingest
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseOpenSentinels(t *testing.T) {
+	// An unparseable closed_at is also read as open, but logged; a
+	// sentinel is expected and isn't
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	l := New(Options{OpenSentinels: []string{"N/A", "OPEN"}})
+	data := `id,created_at,closed_at,category,priority,status
+1,2026-01-05,n/a,VPN,High,Open
+2,2026-01-05,N/A,VPN,High,Open
+3,2026-01-05,Open,VPN,High,Open
+4,2026-01-05, oPeN ,VPN,High,Open
+5,2026-01-05,,VPN,High,Open
+6,2026-01-05,2026-01-06,VPN,High,Closed
+`
+	tickets, stats, err := l.Parse(strings.NewReader(data), "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Loaded != 6 || stats.Skipped != 0 {
+		t.Fatalf("loaded %d, skipped %d; want 6 loaded, none skipped", stats.Loaded, stats.Skipped)
+	}
+	for _, ticket := range tickets {
+		if open := ticket.ClosedAt == nil; open != (ticket.ID != 6) {
+			t.Errorf("ticket %d: closed_at %v, want open %v", ticket.ID, ticket.ClosedAt, ticket.ID != 6)
+		}
+	}
+	if strings.Contains(logged.String(), "invalid closed_at") {
+		t.Errorf("sentinels were logged as invalid:\n%s", logged.String())
+	}
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/loxhness/LogLens/analytics"
+	"github.com/loxhness/LogLens/store"
+)
+
+// aggregateFormats are the representations /api/aggregate can return
+var aggregateFormats = []string{mimeJSON, mimeCSV}
+
+// aggregateMetrics are the values metric= accepts, in output order
+var aggregateMetrics = []string{"count", "open", "closed", "avg_resolution"}
+
+// maxGroupBy bounds how many dimensions one aggregate query may combine
+const maxGroupBy = 4
+
+// parseAggregateQuery reads group_by and metric, both comma-separated
+func parseAggregateQuery(r *http.Request) (by, metrics []string, err error) {
+	q := r.URL.Query()
+	for _, k := range strings.Split(q.Get("group_by"), ",") {
+		if k = strings.ToLower(strings.TrimSpace(k)); k == "" {
+			continue
+		}
+		if !analyzer.IsGroupKey(k) {
+			return nil, nil, fmt.Errorf("invalid group_by %q: want one of %s", k, analyzer.GroupKeyNames())
+		}
+		if containsExact(by, k) {
+			return nil, nil, fmt.Errorf("group_by lists %q twice", k)
+		}
+		by = append(by, k)
+	}
+	if len(by) == 0 {
+		return nil, nil, fmt.Errorf("group_by is required: one or more of %s", analyzer.GroupKeyNames())
+	}
+	if len(by) > maxGroupBy {
+		return nil, nil, fmt.Errorf("group_by takes at most %d keys", maxGroupBy)
+	}
+	want := make(map[string]bool)
+	for _, m := range strings.Split(q.Get("metric"), ",") {
+		if m = strings.ToLower(strings.TrimSpace(m)); m == "" {
+			continue
+		}
+		if !containsExact(aggregateMetrics, m) {
+			return nil, nil, fmt.Errorf("invalid metric %q: want one of %s", m, strings.Join(aggregateMetrics, ", "))
+		}
+		want[m] = true
+	}
+	if len(want) == 0 {
+		want["count"] = true
+	}
+	for _, m := range aggregateMetrics {
+		if want[m] {
+			metrics = append(metrics, m)
+		}
+	}
+	return by, metrics, nil
+}
+
+// handleAggregate serves GET /api/aggregate: the filtered tickets grouped
+// by any combination of group keys, with the chosen metrics per group
+func handleAggregate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	by, metrics, err := parseAggregateQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := responseFormat(r, aggregateFormats)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	groups := aggregateGroups(r, filter, by)
+	setCacheControl(w)
+	w.Header().Set("Vary", "Accept")
+	if format == mimeCSV {
+		writeAggregateCSV(w, by, metrics, groups)
+		return
+	}
+
+	// Only the metrics asked for are included; an avg_resolution_hours
+	// with nothing resolved is null
+	out := make([]map[string]interface{}, 0, len(groups))
+	for _, g := range groups {
+		keys := make(map[string]string, len(by))
+		for i, k := range by {
+			keys[k] = g.Values[i]
+		}
+		row := map[string]interface{}{"keys": keys}
+		for _, m := range metrics {
+			switch m {
+			case "count":
+				row["count"] = g.Count
+			case "open":
+				row["open"] = g.Open
+			case "closed":
+				row["closed"] = g.Count - g.Open
+			case "avg_resolution":
+				row["avg_resolution_hours"] = g.AvgHours()
+			}
+		}
+		out = append(out, row)
+	}
+	w.Header().Set("Content-Type", mimeJSON)
+	json.NewEncoder(w).Encode(struct {
+		GroupBy []string                 `json:"group_by"`
+		Metrics []string                 `json:"metrics"`
+		Groups  []map[string]interface{} `json:"groups"`
+	}{by, metrics, out})
+}
+
+// aggregateGroups groups the filtered tickets, in the database when the
+// project's store can translate the query to SQL. A query it can't
+// translate, or that fails, is grouped in memory instead.
+func aggregateGroups(r *http.Request, f ticketFilter, by []string) []*analytics.Group {
+	if a, ok := f.source().store.(store.Aggregator); ok {
+		q := store.AggregateQuery{
+			By:             by,
+			MinID:          f.minID,
+			MaxID:          f.maxID,
+			Assignee:       f.assignee,
+			Tag:            f.tag,
+			Categories:     f.categories,
+			Priorities:     f.priorities,
+			From:           f.from,
+			Until:          f.until,
+			Location:       location,
+			WeekStart:      weekStart,
+			OpenRule:       *openRule,
+			ClosedStatuses: closedStatuses,
+			CapHours:       *capResolutionHours,
+		}
+		for id := range excludedIDs {
+			q.ExcludedIDs = append(q.ExcludedIDs, id)
+		}
+		sort.Ints(q.ExcludedIDs)
+		if *retainDays > 0 {
+			q.CreatedSince = analyzer.ReferenceTime().AddDate(0, 0, -*retainDays)
+		}
+		groups, err := a.Aggregate(q)
+		if err == nil {
+			return groups
+		}
+		if err != store.ErrUntranslatable {
+			logRequestf(r, "Aggregating in the store failed, grouping in memory: %v", err)
+		}
+	}
+	return analyzer.Aggregate(f.tickets(), by)
+}
+
+// writeAggregateCSV writes one row per group: the key values, then the
+// metrics, with avg_resolution as avg_resolution_hours
+func writeAggregateCSV(w http.ResponseWriter, by, metrics []string, groups []*analytics.Group) {
+	w.Header().Set("Content-Type", mimeCSV)
+	cw := csv.NewWriter(w)
+	header := append([]string{}, by...)
+	for _, m := range metrics {
+		if m == "avg_resolution" {
+			m = "avg_resolution_hours"
+		}
+		header = append(header, m)
+	}
+	cw.Write(header)
+	for _, g := range groups {
+		row := append([]string{}, g.Values...)
+		for _, m := range metrics {
+			switch m {
+			case "count":
+				row = append(row, strconv.Itoa(g.Count))
+			case "open":
+				row = append(row, strconv.Itoa(g.Open))
+			case "closed":
+				row = append(row, strconv.Itoa(g.Count-g.Open))
+			case "avg_resolution":
+				row = append(row, optionalFloat(g.AvgHours()))
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return
+		}
+	}
+	cw.Flush()
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+var (
+	// alertMu guards activeAlert
+	alertMu     sync.RWMutex
+	activeAlert *analytics.Alert
+	alertClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// evaluateAlerts checks the open backlog against -alert-open-threshold after
+// a load. The webhook only fires when the alert is first raised, not on every
+// reload while it stays active.
+func evaluateAlerts(t []analytics.Ticket) {
+	if *alertOpenThreshold <= 0 {
+		alertMu.Lock()
+		activeAlert = nil
+		alertMu.Unlock()
+		return
+	}
+
+	open, _ := analyzer.CountOpenClosed(t)
+
+	alertMu.Lock()
+	if open <= *alertOpenThreshold {
+		activeAlert = nil
+		alertMu.Unlock()
+		return
+	}
+	raised := activeAlert == nil
+	if raised {
+		activeAlert = &analytics.Alert{Type: "open_backlog", Threshold: *alertOpenThreshold, RaisedAt: time.Now()}
+	}
+	activeAlert.Value = open
+	activeAlert.Message = fmt.Sprintf("%d open tickets exceeds threshold of %d", open, *alertOpenThreshold)
+	a := *activeAlert
+	alertMu.Unlock()
+
+	if raised {
+		log.Printf("Alert raised: %s", a.Message)
+		if *alertWebhook != "" {
+			go notify(*alertWebhook, "json", a)
+		}
+	}
+}
+
+// currentAlert returns a copy of the active alert, or nil
+func currentAlert() *analytics.Alert {
+	alertMu.RLock()
+	defer alertMu.RUnlock()
+	if activeAlert == nil {
+		return nil
+	}
+	a := *activeAlert
+	return &a
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// Annotation marks a day on the dashboard's tickets-per-day chart
+type Annotation struct {
+	Date      string `json:"date"`
+	Label     string `json:"label"`
+	Direction string `json:"direction"`
+}
+
+// handleAnomalies serves GET /api/anomalies: the anomalous days of the
+// filtered tickets, with window, sigma and method overriding the flags,
+// plus chart annotations for them
+func handleAnomalies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	filter, err := parseFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	window := *anomalyWindow
+	if n, err := intParam(q, "window"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if n != nil {
+		if *n < 2 {
+			http.Error(w, "window must be at least 2", http.StatusBadRequest)
+			return
+		}
+		window = *n
+	}
+	sigma := *anomalySigma
+	if v := q.Get("sigma"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			http.Error(w, fmt.Sprintf("invalid sigma %q: must be a positive number", v), http.StatusBadRequest)
+			return
+		}
+		sigma = f
+	}
+	method := *anomalyMethod
+	if v := q.Get("method"); v != "" {
+		if !containsExact(analytics.AnomalyMethods, v) {
+			http.Error(w, fmt.Sprintf("invalid method %q: want stddev or mad", v), http.StatusBadRequest)
+			return
+		}
+		method = v
+	}
+
+	days := analytics.DailyCounts(filter.tickets())
+	anomalies := analytics.FindAnomalies(days, method, window, sigma)
+	annotations := make([]Annotation, 0, len(anomalies))
+	for _, a := range anomalies {
+		kind := "High"
+		if a.Direction == "low" {
+			kind = "Low"
+		}
+		annotations = append(annotations, Annotation{
+			Date:      a.Date,
+			Label:     fmt.Sprintf("%s volume: %d tickets (expected %.1f)", kind, a.Count, a.Expected),
+			Direction: a.Direction,
+		})
+	}
+	if anomalies == nil {
+		anomalies = []analytics.DayAnomaly{}
+	}
+	setCacheControl(w)
+	w.Header().Set("Content-Type", mimeJSON)
+	json.NewEncoder(w).Encode(struct {
+		Method      string                 `json:"method"`
+		Window      int                    `json:"window"`
+		Sigma       float64                `json:"sigma"`
+		Days        int                    `json:"days"`
+		Anomalies   []analytics.DayAnomaly `json:"anomalies"`
+		Annotations []Annotation           `json:"annotations"`
+	}{method, window, sigma, len(days), anomalies, annotations})
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// apiKeyHeader is the alternative to "Authorization: Bearer <key>" for
+// clients that can't set Authorization
+const apiKeyHeader = "X-API-Key"
+
+// authRealm is shown by browsers in the basic auth prompt
+const authRealm = "LogLens"
+
+// auth holds the credentials parsed from -api-keys and -basic-auth. Keys and
+// the password are kept as SHA-256 digests so every comparison takes the
+// same time whatever the input's length.
+type auth struct {
+	keys      [][sha256.Size]byte
+	user      string
+	password  [sha256.Size]byte
+	hasBasic  bool
+	protected bool
+}
+
+// parseAuth reads the comma-separated API keys and a "user:password" pair;
+// both empty turns authentication off
+func parseAuth(keys, basic string) (*auth, error) {
+	a := &auth{}
+	for _, k := range strings.Split(keys, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			a.keys = append(a.keys, sha256.Sum256([]byte(k)))
+		}
+	}
+	if basic != "" {
+		i := strings.IndexByte(basic, ':')
+		if i <= 0 || i == len(basic)-1 {
+			return nil, fmt.Errorf("want user:password")
+		}
+		a.user = basic[:i]
+		a.password = sha256.Sum256([]byte(basic[i+1:]))
+		a.hasBasic = true
+	}
+	a.protected = len(a.keys) > 0 || a.hasBasic
+	return a, nil
+}
+
+// apiPath reports whether path is served to programs rather than browsers:
+// those accept an API key and never trigger a login prompt
+func apiPath(path string) bool {
+	return strings.HasPrefix(path, "/api/") || path == "/graphql" || path == "/metrics" || path == "/ws"
+}
+
+// withAuth requires credentials on every path except the health probes.
+// API paths accept an API key or the basic auth login, so the dashboard's
+// own requests work once the browser has logged in; everything else (the
+// dashboard and its data file) takes only the login.
+func withAuth(a *auth, next http.Handler) http.Handler {
+	if !a.protected {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		api := apiPath(r.URL.Path)
+		if a.allowBasic(r) || (api && a.allowKey(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if a.hasBasic && !api {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+authRealm+`", charset="UTF-8"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// allowKey accepts "Authorization: Bearer <key>" or an X-API-Key header
+func (a *auth) allowKey(r *http.Request) bool {
+	key := r.Header.Get(apiKeyHeader)
+	if h := r.Header.Get("Authorization"); key == "" && len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		key = strings.TrimSpace(h[7:])
+	}
+	if key == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(key))
+	ok := 0
+	for i := range a.keys {
+		ok |= subtle.ConstantTimeCompare(sum[:], a.keys[i][:])
+	}
+	return ok == 1
+}
+
+// allowBasic checks basic auth credentials against -basic-auth
+func (a *auth) allowBasic(r *http.Request) bool {
+	if !a.hasBasic {
+		return false
+	}
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	sum := sha256.Sum256([]byte(password))
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(a.user))
+	return userOK&subtle.ConstantTimeCompare(sum[:], a.password[:]) == 1
+}
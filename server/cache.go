@@ -0,0 +1,140 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCachedResponses bounds the response cache; filling it starts over
+const maxCachedResponses = 256
+
+// cachedResponse is a summary response kept for identical requests
+type cachedResponse struct {
+	header http.Header
+	body   []byte
+}
+
+// responseCache holds one project's summary responses for its current
+// ticket generation and cache epoch. Anything from an earlier one is
+// discarded on first use.
+type responseCache struct {
+	mu      sync.Mutex
+	gen     uint64
+	epoch   int64
+	entries map[string]*cachedResponse
+}
+
+// get returns the response cached under key, if it is still current
+func (c *responseCache) get(gen uint64, epoch int64, key string) *cachedResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen || c.epoch != epoch {
+		return nil
+	}
+	return c.entries[key]
+}
+
+func (c *responseCache) put(gen uint64, epoch int64, key string, e *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen || c.epoch != epoch || len(c.entries) >= maxCachedResponses {
+		c.gen, c.epoch, c.entries = gen, epoch, make(map[string]*cachedResponse)
+	}
+	c.entries[key] = e
+}
+
+// cacheEpoch is the -cache-ttl window the current time falls in. Ages and
+// trailing windows move with the clock, so responses expire every window;
+// under -as-of they only change with the data.
+func cacheEpoch() int64 {
+	if !asOfTime.IsZero() {
+		return 0
+	}
+	return time.Now().UnixNano() / int64(*cacheTTL)
+}
+
+// withResponseCache serves repeated GETs of a summary endpoint from memory
+// until the tickets change (a load or an ingest) or the -cache-ttl window
+// rolls over. Responses carry an ETag derived from the same inputs, so a
+// client sending it back in If-None-Match gets a bodyless 304.
+func withResponseCache(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if *cacheTTL <= 0 || r.Method != http.MethodGet {
+			h(w, r)
+			return
+		}
+		// An unknown view or project falls through so the handler can
+		// reject it. A view is keyed by what it holds, so editing it
+		// changes the key.
+		q, err := expandView(r.URL.Query())
+		if err != nil {
+			h(w, r)
+			return
+		}
+		p, err := lookupProject(q.Get("project"))
+		if err != nil {
+			h(w, r)
+			return
+		}
+		gen, epoch := p.ticketGeneration(), cacheEpoch()
+		// The path and query pick the content; Accept picks the format
+		key := r.URL.Path + "?" + q.Encode() + "\n" + r.Header.Get("Accept")
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%d\n%d\n%s", gen, epoch, key)))
+		etag := fmt.Sprintf(`"%x"`, sum[:8])
+
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			w.Header().Set("ETag", etag)
+			setCacheControl(w)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if e := p.cache.get(gen, epoch, key); e != nil {
+			for k, v := range e.header {
+				w.Header()[k] = v
+			}
+			w.Write(e.body)
+			return
+		}
+
+		rec := &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+		h(rec, r)
+		if rec.status == http.StatusOK {
+			rec.header.Set("ETag", etag)
+			p.cache.put(gen, epoch, key, &cachedResponse{header: rec.header, body: rec.buf.Bytes()})
+		}
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.status)
+		w.Write(rec.buf.Bytes())
+	}
+}
+
+// etagMatch reports whether an If-None-Match header lists etag, or is "*"
+func etagMatch(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == etag || t == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedResponse collects a handler's response so it can be cached
+type bufferedResponse struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.buf.Write(p) }
+
+func (b *bufferedResponse) WriteHeader(code int) { b.status = code }
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// defaultOldestOpenLimit is how many open tickets a category detail lists
+// without ?limit=
+const defaultOldestOpenLimit = 10
+
+// handleCategory serves GET /api/categories/{name}: volume, priority mix,
+// resolution percentiles, SLA and backlog for one category, matched
+// case-insensitively. The name is the rest of the path, so slashes in
+// hierarchical categories need no escaping. It takes the summary filters
+// and limit (default 10) for oldest_open; an unknown category is a 404.
+func handleCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/api/categories/")
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	filter, err := parseFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultOldestOpenLimit
+	if n, err := intParam(q, "limit"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if n != nil {
+		if *n < 1 || *n > maxPageSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxPageSize), http.StatusBadRequest)
+			return
+		}
+		limit = *n
+	}
+
+	// Look the name up in the whole project, so a filter that matches
+	// nothing gives an empty detail rather than a 404
+	known := false
+	for _, t := range filter.source().currentTickets() {
+		if strings.EqualFold(t.Category, name) {
+			name, known = t.Category, true
+			break
+		}
+	}
+	if !known {
+		http.Error(w, fmt.Sprintf("unknown category %q", name), http.StatusNotFound)
+		return
+	}
+	var matched []analytics.Ticket
+	for _, t := range filter.tickets() {
+		if strings.EqualFold(t.Category, name) {
+			matched = append(matched, t)
+		}
+	}
+	setCacheControl(w)
+	w.Header().Set("Content-Type", mimeJSON)
+	json.NewEncoder(w).Encode(analyzer.DescribeCategory(name, matched, limit))
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/loxhness/LogLens/analytics"
+	"github.com/loxhness/LogLens/ingest"
+)
+
+// runAnalyze is the analyze command:
+//
+//	loglens analyze [flags] file... [flags]
+//
+// It loads the files ("-" reads stdin, and globs are expanded) like -data,
+// computes the summary and writes it as JSON, without starting the server.
+// Flags may come before or after the files, and the analysis flags (-sla,
+// -timezone, -as-of, -open-rule, ...) apply as they do to the server. It
+// returns the exit status: 1 when loading or writing fails, or when a
+// metric fails with -fail-on-metric-error, and 2 for usage errors.
+func runAnalyze(args []string) int {
+	var paths []string
+	for {
+		flag.CommandLine.Parse(args) // exits on bad flags
+		args = flag.Args()
+		if len(args) == 0 {
+			break
+		}
+		paths, args = append(paths, args[0]), args[1:]
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: loglens analyze [flags] file... (\"-\" reads stdin)")
+		return 2
+	}
+	applyFlags()
+	opts, err := parseSummaryOptions(url.Values{"fields": {*analyzeFields}})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -fields: %v\n", err)
+		return 2
+	}
+
+	tickets, stats, err := loadAnalyzeFiles(paths)
+	if err != nil {
+		log.Printf("Failed to load tickets: %v", err)
+		return 1
+	}
+	if *statusHistory != "" {
+		if err := loader.AttachHistory(tickets, *statusHistory); err != nil {
+			log.Printf("Failed to load -status-history: %v", err)
+			return 1
+		}
+	}
+	log.Printf("Loaded %d tickets (%d skipped, %d rejected, %d flagged, %d purged, %d excluded, %d duplicates)",
+		stats.Loaded, stats.Skipped, stats.Rejected, stats.Flagged, stats.Purged, stats.Excluded, stats.Duplicates)
+
+	s := analyzer.Compute(tickets, opts)
+	var v interface{} = s
+	if opts.Fields != nil {
+		if v, err = analytics.SelectFields(s, opts.Fields); err != nil {
+			log.Printf("Failed to encode summary: %v", err)
+			return 1
+		}
+	}
+	body, err := encodeAnalysis(v, *analyzeOut)
+	if err == nil {
+		if *analyzeOut == "" {
+			_, err = os.Stdout.Write(body)
+		} else {
+			err = os.WriteFile(*analyzeOut, body, 0o644)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to write summary: %v", err)
+		return 1
+	}
+	if s.Partial {
+		log.Printf("Metrics failed: %s", strings.Join(s.FailedMetrics, ", "))
+		if *failOnMetricError {
+			return 1
+		}
+	}
+	return 0
+}
+
+// loadAnalyzeFiles parses the analyze command's files in -format
+func loadAnalyzeFiles(paths []string) ([]analytics.Ticket, ingest.LoadStats, error) {
+	var files []string
+	for _, p := range paths {
+		if p == "-" {
+			if len(paths) > 1 {
+				return nil, ingest.LoadStats{}, fmt.Errorf("stdin (-) can't be combined with files")
+			}
+			return loader.Parse(os.Stdin, config.Format)
+		}
+		if !ingest.IsGlob(p) {
+			files = append(files, p)
+			continue
+		}
+		matched, err := ingest.DataFiles(p)
+		if err != nil {
+			return nil, ingest.LoadStats{}, err
+		}
+		if len(matched) == 0 {
+			return nil, ingest.LoadStats{}, fmt.Errorf("no files match %s", p)
+		}
+		files = append(files, matched...)
+	}
+	if len(files) == 1 {
+		f, err := os.Open(files[0])
+		if err != nil {
+			return nil, ingest.LoadStats{}, err
+		}
+		defer f.Close()
+		return loader.Parse(f, config.Format)
+	}
+	return loader.ParseFiles(files, config.Format)
+}
+
+// encodeAnalysis encodes the summary for the -out path: CSV or NDJSON by
+// its extension, indented JSON otherwise (and on stdout)
+func encodeAnalysis(v interface{}, out string) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	switch strings.ToLower(filepath.Ext(out)) {
+	case ".csv":
+		err = summaryToCSV(w, raw)
+	case ".ndjson", ".jsonl":
+		err = summaryToNDJSON(w, raw)
+	default:
+		err = json.Indent(&buf, raw, "", "  ")
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), err
+}
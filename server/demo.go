@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+const (
+	demoTickets = 300
+	demoDays    = 90
+)
+
+// demoCategories are weighted so the top-categories chart has a clear order
+var demoCategories = []struct {
+	name   string
+	weight int
+}{
+	{"Password Reset", 30},
+	{"Network", 20},
+	{"Printer", 15},
+	{"Software", 15},
+	{"Hardware", 10},
+	{"Email", 10},
+}
+
+// demoPriorities pairs each priority with its share of tickets and mean
+// resolution time in days
+var demoPriorities = []struct {
+	name     string
+	weight   int
+	meanDays float64
+}{
+	{"High", 20, 0.7},
+	{"Medium", 45, 2},
+	{"Low", 35, 5},
+}
+
+// demoCSV generates a synthetic ticket CSV spanning the demoDays before the
+// reference day. The same seed and -as-of always produce the same bytes.
+// Dates are plain YYYY-MM-DD so the browser dashboard can parse them too.
+func demoCSV(seed int64) []byte {
+	rng := rand.New(rand.NewSource(seed))
+	end := analyzer.ReferenceTime().In(location)
+	y, m, d := end.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, location)
+	start := today.AddDate(0, 0, -demoDays+1)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"id", "created_at", "closed_at", "category", "priority", "status"})
+	for i := 0; i < demoTickets; i++ {
+		created := start.AddDate(0, 0, rng.Intn(demoDays))
+		category := demoCategories[weightedPick(rng, len(demoCategories), func(j int) int { return demoCategories[j].weight })].name
+		p := demoPriorities[weightedPick(rng, len(demoPriorities), func(j int) int { return demoPriorities[j].weight })]
+
+		// Exponential resolution times; anything that would close after
+		// the reference day is still open
+		days := int(math.Round(rng.ExpFloat64() * p.meanDays))
+		closed, status := created.AddDate(0, 0, days), "Closed"
+		closedStr := closed.Format(analytics.DateLayout)
+		if closed.After(today) {
+			closedStr, status = "", "Open"
+		}
+		w.Write([]string{
+			strconv.Itoa(i + 1),
+			created.Format(analytics.DateLayout),
+			closedStr,
+			category,
+			p.name,
+			status,
+		})
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// weightedPick returns an index in [0, n) drawn proportionally to weight
+func weightedPick(rng *rand.Rand, n int, weight func(int) int) int {
+	total := 0
+	for i := 0; i < n; i++ {
+		total += weight(i)
+	}
+	r := rng.Intn(total)
+	for i := 0; i < n; i++ {
+		if r -= weight(i); r < 0 {
+			return i
+		}
+	}
+	return n - 1
+}
+
+// handleDemoCSV serves the generated dataset at the path the dashboard
+// fetches, so -demo needs no file on disk
+func handleDemoCSV(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Write(demoCSV(config.DemoSeed))
+}
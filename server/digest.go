@@ -0,0 +1,322 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// digestTopCategories and digestTopBreaches bound the lists a digest carries
+const (
+	digestTopCategories = 5
+	digestTopBreaches   = 10
+)
+
+// defaultDigestTemplate is the digest email used without -digest-template.
+// The "subject" template is the subject line; the rest is the body.
+const defaultDigestTemplate = `{{define "subject"}}LogLens {{.Period}} digest: {{.Label}}{{end -}}
+LogLens {{.Period}} digest for {{.Label}}{{if .Project}} ({{.Project}}){{end}}
+
+Created:        {{num .Created.Current}} ({{signed .Created.Change}}, {{pct .Created.PctChange}} vs previous)
+Closed:         {{num .Closed.Current}} ({{signed .Closed.Change}}, {{pct .Closed.PctChange}})
+Open backlog:   {{num .Backlog.Current}} ({{signed .Backlog.Change}})
+Avg resolution: {{num .AvgResolutionHours.Current}}h ({{signed .AvgResolutionHours.Change}}h)
+
+Top categories
+{{range .TopCategories}}  {{.Category}}: {{.Count}}
+{{else}}  No tickets created
+{{end}}
+SLA breaches: {{.NewBreaches}} new, {{.OpenBreaches}} open past target
+{{range .Breaches}}  #{{.ID}} {{.Priority}} {{.Category}}: {{num .ElapsedHours}}h against {{num .TargetHours}}h{{if .Open}} (open){{end}}
+{{end}}`
+
+// Digest is what a digest template renders: one completed day or week
+// compared with the one before it
+type Digest struct {
+	Period  string // daily or weekly
+	Project string // empty for the default project
+	From    time.Time
+	To      time.Time // exclusive
+	Label   string    // the covered date, or "first to last" for a week
+
+	Created            analytics.Delta // tickets created in the period
+	Closed             analytics.Delta // tickets closed in the period
+	Backlog            analytics.Delta // open at the end of the period against its start
+	AvgResolutionHours analytics.Delta // of the tickets closed in the period
+
+	// TopCategories counts the period's new tickets, largest first
+	TopCategories []analytics.CategoryCount
+	// NewBreaches is the tickets whose SLA target fell due in the period
+	// and was missed; Breaches lists the worst of them
+	NewBreaches  int
+	Breaches     []analytics.SLABreach
+	OpenBreaches int // every ticket still open past its target at To
+}
+
+// digestFuncs are the helpers digest templates can call
+var digestFuncs = template.FuncMap{
+	"num": digestNum,
+	// signed is num with a leading + on increases
+	"signed": func(v float64) string {
+		if v > 0 {
+			return "+" + digestNum(v)
+		}
+		return digestNum(v)
+	},
+	// pct formats a Delta's PctChange, which is nil when there is no base
+	"pct": func(p *float64) string {
+		if p == nil {
+			return "n/a"
+		}
+		return fmt.Sprintf("%+.0f%%", *p)
+	},
+	"date": func(t time.Time) string { return t.In(location).Format(analytics.DateLayout) },
+}
+
+// digestNum formats a count or hours with at most one decimal
+func digestNum(v float64) string {
+	if v == math.Trunc(v) {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
+
+// digestTemplate renders digests; set from -digest-template at startup
+var digestTemplate = template.Must(parseDigestTemplate(""))
+
+// parseDigestTemplate reads a digest template from path, or returns the
+// built-in one when path is empty. A custom template that doesn't define
+// "subject" keeps the built-in subject line.
+func parseDigestTemplate(path string) (*template.Template, error) {
+	t, err := template.New("digest").Funcs(digestFuncs).Parse(defaultDigestTemplate)
+	if err != nil || path == "" {
+		return t, err
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return t.Parse(string(text))
+}
+
+// digestPeriodBounds returns the last complete day or week before now and
+// the one before that, each as [start, end)
+func digestPeriodBounds(period string, now time.Time) (from, to, prior time.Time) {
+	now = now.In(location)
+	y, m, d := now.Date()
+	to = time.Date(y, m, d, 0, 0, 0, 0, location)
+	days := 1
+	if period == "weekly" {
+		to, days = analyzer.StartOfWeek(now), 7
+	}
+	from = to.AddDate(0, 0, -days)
+	return from, to, from.AddDate(0, 0, -days)
+}
+
+// buildDigest summarises t for the last complete period before now
+func buildDigest(t []analytics.Ticket, period string, now time.Time) Digest {
+	from, to, prior := digestPeriodBounds(period, now)
+	last := to.AddDate(0, 0, -1)
+	dg := Digest{Period: period, From: from, To: to, Label: from.Format(analytics.DateLayout)}
+	if period == "weekly" {
+		dg.Label += " to " + last.Format(analytics.DateLayout)
+	}
+
+	in := func(at, start, end time.Time) bool { return !at.Before(start) && at.Before(end) }
+	var created, closed [2]int
+	var hours [2]float64
+	var fresh []analytics.Ticket
+	for _, ticket := range t {
+		switch {
+		case in(ticket.CreatedAt, from, to):
+			created[0]++
+			fresh = append(fresh, ticket)
+		case in(ticket.CreatedAt, prior, from):
+			created[1]++
+		}
+		closedAt, ok := analyzer.ClosedTime(ticket)
+		if !ok {
+			continue
+		}
+		h, _ := analyzer.ResolutionHours(ticket)
+		switch {
+		case in(closedAt, from, to):
+			closed[0]++
+			hours[0] += h
+		case in(closedAt, prior, from):
+			closed[1]++
+			hours[1] += h
+		}
+	}
+	var avg [2]float64
+	for i := range avg {
+		if closed[i] > 0 {
+			avg[i] = hours[i] / float64(closed[i])
+		}
+	}
+	dg.Created = analytics.NewDelta(float64(created[0]), float64(created[1]))
+	dg.Closed = analytics.NewDelta(float64(closed[0]), float64(closed[1]))
+	dg.Backlog = analytics.NewDelta(float64(analyzer.OpenAt(t, to)), float64(analyzer.OpenAt(t, from)))
+	dg.AvgResolutionHours = analytics.NewDelta(avg[0], avg[1])
+
+	dg.TopCategories = analyzer.Compute(fresh, analytics.Options{Fields: map[string]bool{"top_categories": true}}).TopCategories
+	if len(dg.TopCategories) > digestTopCategories {
+		dg.TopCategories = dg.TopCategories[:digestTopCategories]
+	}
+
+	_, breaches := analyzer.SLABreaches(t, to)
+	for _, b := range breaches {
+		if !b.CreatedAt.Before(to) {
+			continue
+		}
+		if b.Open {
+			dg.OpenBreaches++
+		}
+		due := b.CreatedAt.Add(time.Duration(b.TargetHours * float64(time.Hour)))
+		if in(due, from, to) {
+			dg.NewBreaches++
+			if len(dg.Breaches) < digestTopBreaches {
+				dg.Breaches = append(dg.Breaches, b)
+			}
+		}
+	}
+	return dg
+}
+
+// renderDigest executes the digest template, returning the subject line
+// and the body
+func renderDigest(dg Digest) (subject, body string, err error) {
+	var b bytes.Buffer
+	if err := digestTemplate.ExecuteTemplate(&b, "subject", dg); err != nil {
+		return "", "", err
+	}
+	subject = strings.TrimSpace(strings.Join(strings.Fields(b.String()), " "))
+	b.Reset()
+	if err := digestTemplate.Execute(&b, dg); err != nil {
+		return "", "", err
+	}
+	return subject, b.String(), nil
+}
+
+// digestMessage formats an RFC 5322 plain-text email
+func digestMessage(from string, to []string, subject, body string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// sendDigest emails the default project's digest for the last complete
+// period to -digest-to through -smtp-addr. net/smtp upgrades to STARTTLS
+// when the server offers it; -smtp-user turns on PLAIN authentication,
+// which it only allows over TLS or to localhost.
+func sendDigest(period string) error {
+	dg := buildDigest(defaultProject.currentTickets(), period, analyzer.ReferenceTime())
+	subject, body, err := renderDigest(dg)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if config.SMTPUser != "" {
+		host, _, err := net.SplitHostPort(config.SMTPAddr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", config.SMTPUser, config.SMTPPassword, host)
+	}
+	return smtp.SendMail(config.SMTPAddr, auth, config.SMTPFrom, digestTo,
+		digestMessage(config.SMTPFrom, digestTo, subject, body))
+}
+
+// parseClock parses an HH:MM time of day
+func parseClock(s string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("want HH:MM")
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// nextDigestTime returns the first send time after now: hour:minute in
+// -timezone, on -week-start for weekly digests
+func nextDigestTime(period string, hour, minute int, now time.Time) time.Time {
+	now = now.In(location)
+	y, m, d := now.Date()
+	next := time.Date(y, m, d, hour, minute, 0, 0, location)
+	for !next.After(now) || (period == "weekly" && next.Weekday() != weekStart) {
+		d++
+		next = time.Date(y, m, d, hour, minute, 0, 0, location)
+	}
+	return next
+}
+
+// scheduleDigests sends a digest at every send time
+func scheduleDigests(period string, hour, minute int) {
+	for {
+		time.Sleep(time.Until(nextDigestTime(period, hour, minute, time.Now())))
+		if err := sendDigest(period); err != nil {
+			log.Printf("Digest failed: %v", err)
+		} else {
+			log.Printf("Sent %s digest to %d recipients", period, len(digestTo))
+		}
+	}
+}
+
+// handleDigest serves GET /api/digest: the digest email as it would be
+// sent now, for checking a template. It takes period=daily|weekly
+// (default -digest, else daily) and the summary filters.
+func handleDigest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	period := q.Get("period")
+	if period == "" {
+		period = *digestPeriod
+	}
+	if period == "" {
+		period = "daily"
+	}
+	if period != "daily" && period != "weekly" {
+		http.Error(w, "period must be daily or weekly", http.StatusBadRequest)
+		return
+	}
+	q.Del("period")
+	filter, err := parseFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dg := buildDigest(filter.tickets(), period, analyzer.ReferenceTime())
+	if p := filter.source(); p != defaultProject {
+		dg.Project = p.name
+	}
+	subject, body, err := renderDigest(dg)
+	if err != nil {
+		logRequestf(r, "Digest template failed: %v", err)
+		http.Error(w, "Failed to render digest: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setCacheControl(w)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "Subject: %s\n\n%s", subject, body)
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	mimeJSON   = "application/json"
+	mimeCSV    = "text/csv"
+	mimeNDJSON = "application/x-ndjson"
+)
+
+// summaryFormats lists the representations /api/summary can produce; the
+// first is the default.
+var summaryFormats = []string{mimeJSON, mimeCSV, mimeNDJSON}
+
+// formatNames maps ?format= values to the media types they select
+var formatNames = map[string]string{"json": mimeJSON, "csv": mimeCSV, "ndjson": mimeNDJSON}
+
+// responseFormat picks one of offers: ?format= when given, which beats the
+// Accept header, otherwise by negotiating Accept
+func responseFormat(r *http.Request, offers []string) (string, error) {
+	v := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+	if v == "" {
+		return negotiate(r.Header.Get("Accept"), offers), nil
+	}
+	if mime, ok := formatNames[v]; ok && containsExact(offers, mime) {
+		return mime, nil
+	}
+	var names []string
+	for _, offer := range offers {
+		for name, mime := range formatNames {
+			if mime == offer {
+				names = append(names, name)
+			}
+		}
+	}
+	return "", fmt.Errorf("invalid format %q: want %s", v, strings.Join(names, ", "))
+}
+
+// withFormat serves h as though ?format=name had been given, for suffixed
+// aliases such as /api/summary.csv
+func withFormat(name string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		q.Set("format", name)
+		r.URL.RawQuery = q.Encode()
+		h(w, r)
+	}
+}
+
+// negotiate picks the offer with the highest q-value in an Accept header.
+// Ties go to the earlier offer; no acceptable offer falls back to offers[0].
+func negotiate(accept string, offers []string) string {
+	best, bestQ := offers[0], acceptQ(accept, offers[0])
+	for _, offer := range offers[1:] {
+		if q := acceptQ(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQ returns the q-value the Accept header assigns to mime, using the
+// most specific matching media range
+func acceptQ(accept, mime string) float64 {
+	if strings.TrimSpace(accept) == "" {
+		return 0
+	}
+	typ := mime[:strings.Index(mime, "/")]
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		rng := strings.ToLower(strings.TrimSpace(fields[0]))
+		s := -1
+		switch rng {
+		case mime:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s < 0 || s < specificity {
+			continue
+		}
+		rq := 1.0
+		for _, p := range fields[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					rq = v
+				}
+			}
+		}
+		if s > specificity || rq > q {
+			q, specificity = rq, s
+		}
+	}
+	return q
+}
+
+// writeSummary encodes v (a Summary or a field subset of one) in the format
+// the client asked for with ?format= or Accept
+func writeSummary(w http.ResponseWriter, r *http.Request, v interface{}) {
+	format, err := responseFormat(r, summaryFormats)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Vary", "Accept")
+	writeSummaryAs(w, format, v)
+}
+
+func writeSummaryAs(w http.ResponseWriter, format string, v interface{}) {
+	if format == mimeJSON {
+		w.Header().Set("Content-Type", mimeJSON)
+		json.NewEncoder(w).Encode(v)
+		return
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Failed to encode summary: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	switch format {
+	case mimeCSV:
+		err = summaryToCSV(&buf, raw)
+	case mimeNDJSON:
+		err = summaryToNDJSON(&buf, raw)
+	}
+	if err != nil {
+		http.Error(w, "Failed to encode summary: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", format)
+	w.Write(buf.Bytes())
+}
+
+// member is one key/value pair of a JSON object, kept in document order
+type member struct {
+	Key   string
+	Value json.RawMessage
+}
+
+// objectMembers decodes a JSON object preserving key order; ok is false if
+// raw is not an object
+func objectMembers(raw json.RawMessage) (members []member, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	tok, err := dec.Token()
+	if err != nil || tok != json.Delim('{') {
+		return nil, false
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, false
+		}
+		members = append(members, member{Key: tok.(string), Value: v})
+	}
+	return members, true
+}
+
+func isArray(raw json.RawMessage) bool {
+	return len(raw) > 0 && raw[0] == '['
+}
+
+// cellText renders a JSON value as a CSV cell: strings unquoted, null empty,
+// everything else as its JSON text
+func cellText(raw json.RawMessage) string {
+	if string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// summaryToCSV writes scalar fields as a key,value "summary" table followed
+// by one titled table per list field, separated by blank lines.
+func summaryToCSV(out io.Writer, raw json.RawMessage) error {
+	members, _ := objectMembers(raw)
+	cw := csv.NewWriter(out)
+
+	var scalars [][]string
+	for _, m := range members {
+		if isArray(m.Value) {
+			continue
+		}
+		if sub, ok := objectMembers(m.Value); ok {
+			for _, f := range sub {
+				scalars = append(scalars, []string{m.Key + "." + f.Key, cellText(f.Value)})
+			}
+			continue
+		}
+		scalars = append(scalars, []string{m.Key, cellText(m.Value)})
+	}
+	if len(scalars) > 0 {
+		cw.Write([]string{"summary"})
+		cw.Write([]string{"key", "value"})
+		cw.WriteAll(scalars)
+	}
+
+	for _, m := range members {
+		if !isArray(m.Value) {
+			continue
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal(m.Value, &items); err != nil {
+			return err
+		}
+		cw.Write(nil)
+		cw.Write([]string{m.Key})
+
+		// Columns are the union of item keys in first-seen order
+		var header []string
+		seen := make(map[string]bool)
+		rows := make([]map[string]string, len(items))
+		for i, item := range items {
+			rows[i] = make(map[string]string)
+			fields, ok := objectMembers(item)
+			if !ok {
+				fields = []member{{Key: "value", Value: item}}
+			}
+			for _, f := range fields {
+				if !seen[f.Key] {
+					seen[f.Key] = true
+					header = append(header, f.Key)
+				}
+				rows[i][f.Key] = cellText(f.Value)
+			}
+		}
+		cw.Write(header)
+		for _, row := range rows {
+			rec := make([]string, len(header))
+			for i, h := range header {
+				rec[i] = row[h]
+			}
+			cw.Write(rec)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// summaryToNDJSON writes one object per line tagged with its "metric": each
+// list item becomes its own line, scalars become {"metric","value"}.
+func summaryToNDJSON(out io.Writer, raw json.RawMessage) error {
+	members, _ := objectMembers(raw)
+	enc := json.NewEncoder(out)
+	for _, m := range members {
+		var items []json.RawMessage
+		if !isArray(m.Value) {
+			items = []json.RawMessage{m.Value}
+		} else if err := json.Unmarshal(m.Value, &items); err != nil {
+			return err
+		}
+		for _, item := range items {
+			line := map[string]interface{}{"metric": m.Key}
+			var obj map[string]interface{}
+			if err := json.Unmarshal(item, &obj); err == nil && obj != nil {
+				for k, v := range obj {
+					line[k] = v
+				}
+			} else {
+				line["value"] = item
+			}
+			if err := enc.Encode(line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mimeJSONL is the other common media type for newline-delimited JSON
+const mimeJSONL = "application/jsonl"
+
+// mediaType returns the lower-cased type/subtype of a Content-Type header
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// ticketFilter restricts which tickets a request aggregates. Zero-value
+// fields don't filter.
+type ticketFilter struct {
+	project      *dataset // ?project=; the default project when nil
+	minID, maxID *int
+	assignee     string // matched case-insensitively
+	tag          string // any of the ticket's tags, likewise
+	// any of these, ignoring case
+	categories, priorities []string
+	// created_at window: from inclusive, until exclusive
+	from, until *time.Time
+}
+
+// parseFilter reads filter query params shared by the API endpoints. A
+// ?view= supplies the params of a saved view; see expandView.
+func parseFilter(q url.Values) (ticketFilter, error) {
+	var f ticketFilter
+	q, err := expandView(q)
+	if err != nil {
+		return f, err
+	}
+	if f.project, err = lookupProject(strings.TrimSpace(q.Get("project"))); err != nil {
+		return f, err
+	}
+	if f.minID, err = intParam(q, "min_id"); err != nil {
+		return f, err
+	}
+	if f.maxID, err = intParam(q, "max_id"); err != nil {
+		return f, err
+	}
+	f.assignee = strings.TrimSpace(q.Get("assignee"))
+	f.tag = strings.TrimSpace(q.Get("tag"))
+	f.categories = listParam(q, "categories")
+	f.priorities = listParam(q, "priorities")
+	if f.from, err = timeParam(q, "from"); err != nil {
+		return f, err
+	}
+	if f.until, err = timeParam(q, "to"); err != nil {
+		return f, err
+	}
+	if f.until != nil && len(strings.TrimSpace(q.Get("to"))) == len(analytics.DateLayout) {
+		end := f.until.AddDate(0, 0, 1) // a bare date includes that whole day
+		f.until = &end
+	}
+	if f.from != nil && f.until != nil && !f.until.After(*f.from) {
+		return f, fmt.Errorf("invalid range: to must be after from")
+	}
+	return f, nil
+}
+
+func timeParam(q url.Values, name string) (*time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := loader.ParseTimestamp(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: want YYYY-MM-DD or RFC3339", name, v)
+	}
+	return &t, nil
+}
+
+// listParam reads a comma-separated param, which may also be repeated
+func listParam(q url.Values, name string) []string {
+	var out []string
+	for _, v := range q[name] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+func intParam(q url.Values, name string) (*int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: must be an integer", name, v)
+	}
+	return &n, nil
+}
+
+func (f ticketFilter) active() bool {
+	return f.minID != nil || f.maxID != nil || f.assignee != "" || f.tag != "" || f.from != nil || f.until != nil ||
+		len(f.categories) > 0 || len(f.priorities) > 0
+}
+
+func (f ticketFilter) match(t analytics.Ticket) bool {
+	if f.minID != nil && t.ID < *f.minID {
+		return false
+	}
+	if f.maxID != nil && t.ID > *f.maxID {
+		return false
+	}
+	if f.assignee != "" && !strings.EqualFold(t.Assignee, f.assignee) {
+		return false
+	}
+	if f.tag != "" && !hasTag(t.Tags, f.tag) {
+		return false
+	}
+	if len(f.categories) > 0 && !containsFold(f.categories, t.Category) {
+		return false
+	}
+	if len(f.priorities) > 0 && !containsFold(f.priorities, t.Priority) {
+		return false
+	}
+	if f.from != nil && t.CreatedAt.Before(*f.from) {
+		return false
+	}
+	if f.until != nil && !t.CreatedAt.Before(*f.until) {
+		return false
+	}
+	return true
+}
+
+// source is the project the filter reads from
+func (f ticketFilter) source() *dataset {
+	if f.project == nil {
+		return defaultProject
+	}
+	return f.project
+}
+
+// tickets returns the matching tickets of the filter's project
+func (f ticketFilter) tickets() []analytics.Ticket {
+	return f.apply(f.source().currentTickets())
+}
+
+// apply returns the matching tickets in a new slice; t itself is returned
+// unchanged when no filter is set
+func (f ticketFilter) apply(t []analytics.Ticket) []analytics.Ticket {
+	if !f.active() {
+		return t
+	}
+	var out []analytics.Ticket
+	for _, ticket := range t {
+		if f.match(ticket) {
+			out = append(out, ticket)
+		}
+	}
+	return out
+}
+
+// hasTag reports whether tags holds tag, ignoring case
+func hasTag(tags []string, tag string) bool {
+	return containsFold(tags, tag)
+}
+
+// containsFold reports whether list holds v, ignoring case
+func containsFold(list []string, v string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
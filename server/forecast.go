@@ -0,0 +1,39 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// maxForecastDays bounds /api/forecast?days=
+const maxForecastDays = 90
+
+// handleForecast serves GET /api/forecast?days=N (default 14) for the
+// filtered tickets
+func handleForecast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	filter, err := parseFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	days := 14
+	if n, err := intParam(q, "days"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if n != nil {
+		if *n < 1 || *n > maxForecastDays {
+			http.Error(w, fmt.Sprintf("days must be between 1 and %d", maxForecastDays), http.StatusBadRequest)
+			return
+		}
+		days = *n
+	}
+	setCacheControl(w)
+	w.Header().Set("Content-Type", mimeJSON)
+	json.NewEncoder(w).Encode(analyzer.ForecastDaily(filter.tickets(), analyzer.ReferenceTime(), days))
+}
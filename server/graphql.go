@@ -0,0 +1,679 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// /graphql serves a read-only subset of GraphQL: a single query operation
+// made of fields, aliases, arguments and variables. Fragments, directives
+// and mutations are rejected. There is no introspection; the schema is
+// the REST JSON shapes, so field names are the same snake_case keys.
+//
+//	tickets(filters, sort, order, limit, offset): [Ticket]
+//	ticket_count(filters): Int
+//	summary(min_id, max_id, from, to, assignee, tag, project, hierarchical): Summary
+//	group_by(by, filters): [Group]
+//
+// filters are min_id, max_id, from, to, assignee, tag and project as on the
+// REST API, plus exact category, priority, status and open: Boolean.
+
+const (
+	gqlDefaultLimit = 100
+	gqlMaxLimit     = 1000
+
+	// maxGraphQLBody bounds a POST /graphql body, variables included
+	maxGraphQLBody = 1 << 20
+	// maxGraphQLQuery bounds the query text, however it was sent
+	maxGraphQLQuery = 16 << 10
+	// maxGraphQLDepth bounds how deeply selection sets and list values
+	// nest; the schema itself is a few levels deep
+	maxGraphQLDepth = 10
+)
+
+// gqlRequest is a GraphQL-over-HTTP request
+type gqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type gqlError struct {
+	Message string   `json:"message"`
+	Path    []string `json:"path,omitempty"`
+}
+
+type gqlResponse struct {
+	Data   *gqlObject `json:"data,omitempty"`
+	Errors []gqlError `json:"errors,omitempty"`
+}
+
+// handleGraphQL accepts the query as a JSON POST body or as ?query= (with
+// optional ?variables= JSON) on GET
+func handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req gqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		if v := r.URL.Query().Get("variables"); v != "" {
+			if err := decodeJSONNumbers(strings.NewReader(v), &req.Variables); err != nil {
+				writeGraphQL(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: "invalid variables: " + err.Error()}}})
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := decodeJSONNumbers(http.MaxBytesReader(w, r.Body, maxGraphQLBody), &req); err != nil {
+			writeGraphQL(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: "invalid request body: " + err.Error()}}})
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if len(req.Query) > maxGraphQLQuery {
+		writeGraphQL(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: fmt.Sprintf("query is longer than %d bytes", maxGraphQLQuery)}}})
+		return
+	}
+
+	fields, err := parseGraphQL(req.Query, req.Variables)
+	if err != nil {
+		writeGraphQL(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: err.Error()}}})
+		return
+	}
+	var resp gqlResponse
+	resp.Data = &gqlObject{}
+	for _, f := range fields {
+		v, err := resolveRoot(f)
+		if err != nil {
+			resp.Errors = append(resp.Errors, gqlError{Message: err.Error(), Path: []string{f.key()}})
+			v = nil
+		}
+		resp.Data.set(f.key(), v)
+	}
+	writeGraphQL(w, http.StatusOK, resp)
+}
+
+func writeGraphQL(w http.ResponseWriter, status int, resp gqlResponse) {
+	w.Header().Set("Content-Type", mimeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func decodeJSONNumbers(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// gqlField is one field of a selection set, with variables already
+// substituted into its arguments
+type gqlField struct {
+	alias, name string
+	args        map[string]interface{}
+	sel         []gqlField
+}
+
+// key is the field's name in the response
+func (f gqlField) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+// gqlObject is a response object that keeps fields in query order
+type gqlObject struct {
+	keys []string
+	vals []interface{}
+}
+
+func (o *gqlObject) set(k string, v interface{}) {
+	o.keys = append(o.keys, k)
+	o.vals = append(o.vals, v)
+}
+
+func (o *gqlObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, _ := json.Marshal(k)
+		buf.Write(kb)
+		buf.WriteByte(':')
+		vb, err := json.Marshal(o.vals[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Lexing and parsing
+
+type gqlToken struct {
+	kind byte // 'n' name, 's' string, '0' number, 'p' punctuator, 0 at end
+	text string
+}
+
+func lexGraphQL(src string) ([]gqlToken, error) {
+	var toks []gqlToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++ // commas are insignificant in GraphQL
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.IndexByte("{}():$!=[]@", c) >= 0:
+			toks = append(toks, gqlToken{'p', string(c)})
+			i++
+		case c == '.':
+			if !strings.HasPrefix(src[i:], "...") {
+				return nil, fmt.Errorf("unexpected %q", c)
+			}
+			toks = append(toks, gqlToken{'p', "..."})
+			i += 3
+		case c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z':
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || src[j] >= '0' && src[j] <= '9' ||
+				src[j] >= 'A' && src[j] <= 'Z' || src[j] >= 'a' && src[j] <= 'z') {
+				j++
+			}
+			toks = append(toks, gqlToken{'n', src[i:j]})
+			i = j
+		case c == '-' || c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(src) && strings.IndexByte("0123456789.eE+-", src[j]) >= 0 {
+				j++
+			}
+			toks = append(toks, gqlToken{'0', src[i:j]})
+			i = j
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			s, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", src[i:j+1])
+			}
+			toks = append(toks, gqlToken{'s', s})
+			i = j + 1
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return toks, nil
+}
+
+type gqlParser struct {
+	toks  []gqlToken
+	pos   int
+	vars  map[string]interface{}
+	depth int // selection sets and lists currently open
+}
+
+func (p *gqlParser) peek() gqlToken {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return gqlToken{}
+}
+
+func (p *gqlParser) next() gqlToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *gqlParser) isPunct(s string) bool {
+	t := p.peek()
+	return t.kind == 'p' && t.text == s
+}
+
+// enter counts one more level of nesting, failing past maxGraphQLDepth;
+// the caller must call p.leave when the level closes
+func (p *gqlParser) enter() error {
+	p.depth++
+	if p.depth > maxGraphQLDepth {
+		return fmt.Errorf("query nests deeper than %d levels", maxGraphQLDepth)
+	}
+	return nil
+}
+
+func (p *gqlParser) leave() { p.depth-- }
+
+func (p *gqlParser) expect(s string) error {
+	if t := p.next(); t.kind != 'p' || t.text != s {
+		return fmt.Errorf("expected %q, got %q", s, t.text)
+	}
+	return nil
+}
+
+// parseGraphQL parses a single query operation into its root fields
+func parseGraphQL(src string, vars map[string]interface{}) ([]gqlField, error) {
+	toks, err := lexGraphQL(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 0 {
+		return nil, fmt.Errorf("missing query")
+	}
+	p := &gqlParser{toks: toks, vars: vars}
+	if t := p.peek(); t.kind == 'n' {
+		if t.text != "query" {
+			return nil, fmt.Errorf("only query operations are supported, not %s", t.text)
+		}
+		p.next()
+		if p.peek().kind == 'n' {
+			p.next() // operation name
+		}
+		if p.isPunct("(") {
+			// Variable definitions; values come from the request, so the
+			// declared types are only skipped over
+			for p.next().text != ")" {
+				if p.pos > len(p.toks) {
+					return nil, fmt.Errorf("unterminated variable definitions")
+				}
+			}
+		}
+	}
+	fields, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("only one operation is supported")
+	}
+	return fields, nil
+}
+
+func (p *gqlParser) selectionSet() ([]gqlField, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	var fields []gqlField
+	for !p.isPunct("}") {
+		if p.pos >= len(p.toks) {
+			return nil, fmt.Errorf("unterminated selection set")
+		}
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	p.next()
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty selection set")
+	}
+	return fields, nil
+}
+
+func (p *gqlParser) field() (gqlField, error) {
+	var f gqlField
+	t := p.next()
+	switch {
+	case t.kind == 'p' && t.text == "...":
+		return f, fmt.Errorf("fragments are not supported")
+	case t.kind != 'n':
+		return f, fmt.Errorf("expected a field name, got %q", t.text)
+	}
+	f.name = t.text
+	if p.isPunct(":") {
+		p.next()
+		if t = p.next(); t.kind != 'n' {
+			return f, fmt.Errorf("expected a field name after alias %s", f.name)
+		}
+		f.alias, f.name = f.name, t.text
+	}
+	if p.isPunct("(") {
+		p.next()
+		f.args = make(map[string]interface{})
+		for !p.isPunct(")") {
+			name := p.next()
+			if name.kind != 'n' {
+				return f, fmt.Errorf("expected an argument name on %s, got %q", f.name, name.text)
+			}
+			if err := p.expect(":"); err != nil {
+				return f, err
+			}
+			v, err := p.value()
+			if err != nil {
+				return f, err
+			}
+			f.args[name.text] = v
+		}
+		p.next()
+	}
+	if p.isPunct("@") {
+		return f, fmt.Errorf("directives are not supported")
+	}
+	if p.isPunct("{") {
+		sel, err := p.selectionSet()
+		if err != nil {
+			return f, err
+		}
+		f.sel = sel
+	}
+	return f, nil
+}
+
+func (p *gqlParser) value() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case 's':
+		return t.text, nil
+	case '0':
+		return json.Number(t.text), nil
+	case 'n':
+		switch t.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return t.text, nil // enum value
+	}
+	switch t.text {
+	case "$":
+		name := p.next()
+		if name.kind != 'n' {
+			return nil, fmt.Errorf("expected a variable name after $")
+		}
+		return p.vars[name.text], nil
+	case "[":
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		var list []interface{}
+		for !p.isPunct("]") {
+			if p.pos >= len(p.toks) {
+				return nil, fmt.Errorf("unterminated list")
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		p.next()
+		return list, nil
+	}
+	return nil, fmt.Errorf("unexpected %q in argument value", t.text)
+}
+
+// Execution
+
+// gqlFilterArgs are the REST filter parameters every root field accepts
+var gqlFilterArgs = []string{"min_id", "max_id", "from", "to", "assignee", "tag", "project"}
+
+// gqlRootArgs lists the arguments each root field accepts beyond
+// gqlFilterArgs
+var gqlRootArgs = map[string][]string{
+	"tickets":      {"category", "priority", "status", "open", "sort", "order", "limit", "offset"},
+	"ticket_count": {"category", "priority", "status", "open"},
+	"summary":      {"hierarchical"},
+	"group_by":     {"by", "category", "priority", "status", "open"},
+	"__typename":   nil,
+}
+
+// gqlTicketFields are Ticket's fields, including those JSON omits when empty
+var gqlTicketFields = []string{"id", "created_at", "closed_at", "category", "priority", "status",
+	"reassignment_count", "reopened_count", "first_response_at", "assignee", "tags",
+	"resolution_hours", "age_hours", "first_response_hours"}
+
+var gqlGroupFields = []string{"key", "count", "open", "closed", "avg_resolution_hours"}
+
+func resolveRoot(f gqlField) (interface{}, error) {
+	extra, ok := gqlRootArgs[f.name]
+	if !ok {
+		return nil, fmt.Errorf("cannot query field %q on type Query", f.name)
+	}
+	if f.name == "__typename" {
+		return "Query", nil
+	}
+	q := url.Values{}
+	for name, v := range f.args {
+		if !containsExact(gqlFilterArgs, name) && !containsExact(extra, name) {
+			return nil, fmt.Errorf("unknown argument %q on field %q", name, f.name)
+		}
+		if v != nil {
+			q.Set(name, fmt.Sprint(v))
+		}
+	}
+
+	if f.name == "summary" {
+		return resolveSummary(f, q)
+	}
+	filter, err := parseFilter(q)
+	if err != nil {
+		return nil, err
+	}
+	matched := filter.tickets()
+	if matched, err = gqlMatch(matched, q); err != nil {
+		return nil, err
+	}
+
+	switch f.name {
+	case "ticket_count":
+		if f.sel != nil {
+			return nil, fmt.Errorf("field %q has no subfields", f.name)
+		}
+		return len(matched), nil
+	case "tickets":
+		return resolveTickets(f, matched, q)
+	}
+	return resolveGroupBy(f, matched, q.Get("by"))
+}
+
+// gqlMatch applies the exact-match arguments the REST filter lacks
+func gqlMatch(t []analytics.Ticket, q url.Values) ([]analytics.Ticket, error) {
+	var open *bool
+	if v := q.Get("open"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid open %q: want a Boolean", v)
+		}
+		open = &b
+	}
+	category, priority, status := q.Get("category"), q.Get("priority"), q.Get("status")
+	if open == nil && category == "" && priority == "" && status == "" {
+		return t, nil
+	}
+	var out []analytics.Ticket
+	for _, ticket := range t {
+		if (category != "" && ticket.Category != category) ||
+			(priority != "" && ticket.Priority != priority) ||
+			(status != "" && ticket.Status != status) ||
+			(open != nil && analyzer.IsClosed(ticket) == *open) {
+			continue
+		}
+		out = append(out, ticket)
+	}
+	return out, nil
+}
+
+func resolveTickets(f gqlField, matched []analytics.Ticket, q url.Values) (interface{}, error) {
+	less, err := ticketOrder(q)
+	if err != nil {
+		return nil, err
+	}
+	limit, offset := gqlDefaultLimit, 0
+	if v, err := intParam(q, "limit"); err != nil {
+		return nil, err
+	} else if v != nil {
+		if *v < 0 || *v > gqlMaxLimit {
+			return nil, fmt.Errorf("invalid limit %d: want 0 to %d", *v, gqlMaxLimit)
+		}
+		limit = *v
+	}
+	if v, err := intParam(q, "offset"); err != nil {
+		return nil, err
+	} else if v != nil {
+		if *v < 0 {
+			return nil, fmt.Errorf("invalid offset %d: must not be negative", *v)
+		}
+		offset = *v
+	}
+	matched = sortedTickets(matched, less)
+	if offset > len(matched) {
+		offset = len(matched)
+	}
+	if offset+limit < len(matched) {
+		matched = matched[:offset+limit]
+	}
+	matched = matched[offset:]
+
+	now := analyzer.ReferenceTime()
+	out := make([]interface{}, 0, len(matched))
+	for _, t := range matched {
+		v, err := project(toJSONValue(newTicketRecord(t, now)), f, "Ticket", gqlTicketFields)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func resolveSummary(f gqlField, q url.Values) (interface{}, error) {
+	if f.sel == nil {
+		return nil, fmt.Errorf("field %q of type Summary must have a selection of subfields", f.name)
+	}
+	var names []string
+	for _, sub := range f.sel {
+		if sub.name != "__typename" {
+			names = append(names, sub.name)
+		}
+	}
+	if len(names) > 0 {
+		q.Set("fields", strings.Join(names, ","))
+	}
+	opts, err := parseSummaryOptions(q)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := parseFilter(q)
+	if err != nil {
+		return nil, err
+	}
+	return project(toJSONValue(summaryFor(filter, opts)), f, "Summary", nil)
+}
+
+// resolveGroupBy counts matched tickets per value of the by key
+func resolveGroupBy(f gqlField, matched []analytics.Ticket, by string) (interface{}, error) {
+	if !analyzer.IsGroupKey(by) {
+		return nil, fmt.Errorf("invalid by %q: want one of %s", by, analyzer.GroupKeyNames())
+	}
+	type group struct {
+		Key      string   `json:"key"`
+		Count    int      `json:"count"`
+		Open     int      `json:"open"`
+		Closed   int      `json:"closed"`
+		AvgHours *float64 `json:"avg_resolution_hours"`
+	}
+	groups := analyzer.Aggregate(matched, []string{by})
+	out := make([]interface{}, 0, len(groups))
+	for _, g := range groups {
+		v, err := project(toJSONValue(group{g.Values[0], g.Count, g.Open, g.Count - g.Open, g.AvgHours()}), f, "Group", gqlGroupFields)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// toJSONValue converts v to the generic form encoding/json decodes into,
+// so results can be projected by key
+func toJSONValue(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out interface{}
+	decodeJSONNumbers(bytes.NewReader(b), &out)
+	return out
+}
+
+// project picks f's selection out of a JSON object. known lists fields
+// that are valid even when absent from v; nil means the summary's fields.
+func project(v interface{}, f gqlField, typ string, known []string) (interface{}, error) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("field %q is not an object", f.name)
+	}
+	if f.sel == nil {
+		return nil, fmt.Errorf("field %q of type %s must have a selection of subfields", f.name, typ)
+	}
+	out := &gqlObject{}
+	for _, sub := range f.sel {
+		if sub.args != nil {
+			return nil, fmt.Errorf("unknown argument on field %q", sub.name)
+		}
+		if sub.name == "__typename" {
+			out.set(sub.key(), typ)
+			continue
+		}
+		val, present := obj[sub.name]
+		if !present && !containsExact(known, sub.name) && (known != nil || !analytics.KnownField(sub.name)) {
+			return nil, fmt.Errorf("cannot query field %q on type %s", sub.name, typ)
+		}
+		sv, err := projectValue(val, sub)
+		if err != nil {
+			return nil, err
+		}
+		out.set(sub.key(), sv)
+	}
+	return out, nil
+}
+
+// projectValue applies a nested selection to objects and lists of them;
+// scalars must not have one
+func projectValue(v interface{}, f gqlField) (interface{}, error) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		return project(x, f, "Object", []string{})
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, el := range x {
+			pv, err := projectValue(el, f)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = pv
+		}
+		return out, nil
+	}
+	if f.sel != nil {
+		return nil, fmt.Errorf("field %q has no subfields", f.name)
+	}
+	return v, nil
+}
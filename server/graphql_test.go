@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+func TestParseGraphQL(t *testing.T) {
+	fields, err := parseGraphQL(`query Open($cat: String, $open: Boolean!) {
+		vpn: ticket_count(category: $cat, open: $open)
+		tickets(status: "Say \"hi\"", limit: 2, priority: [High, Low]) { id ref: category }
+	}`, map[string]interface{}{"cat": "VPN", "open": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 2 {
+		t.Fatalf("got %d root fields, want 2", len(fields))
+	}
+	count, tickets := fields[0], fields[1]
+	if count.alias != "vpn" || count.name != "ticket_count" || count.key() != "vpn" {
+		t.Errorf("aliased field: alias %q, name %q, key %q", count.alias, count.name, count.key())
+	}
+	if want := map[string]interface{}{"category": "VPN", "open": true}; !reflect.DeepEqual(count.args, want) {
+		t.Errorf("variables: args %v, want %v", count.args, want)
+	}
+	want := map[string]interface{}{"status": `Say "hi"`, "limit": json.Number("2"), "priority": []interface{}{"High", "Low"}}
+	if !reflect.DeepEqual(tickets.args, want) {
+		t.Errorf("literals: args %v, want %v", tickets.args, want)
+	}
+	if len(tickets.sel) != 2 || tickets.sel[1].key() != "ref" || tickets.sel[1].name != "category" {
+		t.Errorf("selection: %+v", tickets.sel)
+	}
+}
+
+func TestParseGraphQLErrors(t *testing.T) {
+	nested := func(n int) string {
+		return strings.Repeat("{ a ", n) + strings.Repeat("}", n)
+	}
+	list := func(n int) string {
+		return "{ a(b: " + strings.Repeat("[", n) + strings.Repeat("]", n) + ") }"
+	}
+	if _, err := parseGraphQL(nested(maxGraphQLDepth), nil); err != nil {
+		t.Errorf("selections %d deep: %v", maxGraphQLDepth, err)
+	}
+	tests := []struct {
+		query, err string
+	}{
+		{"", "missing query"},
+		{"{ tickets % }", `unexpected '%'`},
+		{"{ a.b }", `unexpected '.'`},
+		{"{ a(b: ) }", `unexpected ")" in argument value`},
+		{`{ tickets(category: "VPN) { id } }`, "unterminated string"},
+		{`{ tickets(category: "\q") { id } }`, "invalid string"},
+		{"{ tickets { id }", "unterminated selection set"},
+		{"{ }", "empty selection set"},
+		{"{ a: }", "expected a field name after alias a"},
+		{"mutation { a }", "only query operations are supported"},
+		{"{ a } { b }", "only one operation is supported"},
+		{"{ ...f }", "fragments are not supported"},
+		{"{ a @skip }", "directives are not supported"},
+		{nested(maxGraphQLDepth + 1), "deeper than"},
+		{list(maxGraphQLDepth), "deeper than"},
+	}
+	for _, tt := range tests {
+		_, err := parseGraphQL(tt.query, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%.40q: error %v, want %q", tt.query, err, tt.err)
+		}
+	}
+}
+
+// useTickets loads t into the default project with default analysis
+// settings for the rest of the test
+func useTickets(t *testing.T, tickets []analytics.Ticket) {
+	prev, prevTickets := analyzer, defaultProject.currentTickets()
+	settings := analytics.DefaultSettings()
+	settings.AsOf = time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	analyzer = analytics.New(settings)
+	defaultProject.setTickets(tickets)
+	t.Cleanup(func() {
+		defaultProject.setTickets(prevTickets)
+		analyzer = prev
+	})
+}
+
+func TestGraphQLResolve(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 9, 0, 0, 0, time.UTC) }
+	closed := day(3)
+	useTickets(t, []analytics.Ticket{
+		{ID: 3, CreatedAt: day(2), ClosedAt: &closed, Category: "VPN", Priority: "High", Status: "Closed"},
+		{ID: 1, CreatedAt: day(1), Category: "VPN", Priority: "Low", Status: "Open"},
+		{ID: 2, CreatedAt: day(1), Category: "Printer", Priority: "High", Status: "Open"},
+	})
+
+	body := `{"query": "query($cat: String) { open: ticket_count(open: true) vpn: ticket_count(category: $cat) ` +
+		`tickets(sort: \"id\", order: \"desc\", limit: 2) { id category __typename } ` +
+		`group_by(by: \"category\") { key count open avg_resolution_hours } ` +
+		`summary { total_tickets open_tickets } nope }", "variables": {"cat": "VPN"}}`
+	rec := httptest.NewRecorder()
+	handleGraphQL(rec, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	want := `{"data":{"open":2,"vpn":2,` +
+		`"tickets":[{"id":3,"category":"VPN","__typename":"Ticket"},{"id":2,"category":"Printer","__typename":"Ticket"}],` +
+		`"group_by":[{"key":"VPN","count":2,"open":1,"avg_resolution_hours":24},{"key":"Printer","count":1,"open":1,"avg_resolution_hours":null}],` +
+		`"summary":{"total_tickets":3,"open_tickets":2},"nope":null},` +
+		`"errors":[{"message":"cannot query field \"nope\" on type Query","path":["nope"]}]}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	useTickets(t, nil)
+	long := "{ " + strings.Repeat("ticket_count ", maxGraphQLQuery/13+1) + "}"
+	requests := map[string]*http.Request{
+		"long GET query": httptest.NewRequest(http.MethodGet, "/graphql?query="+strings.ReplaceAll(long, " ", "+"), nil),
+		"large POST body": httptest.NewRequest(http.MethodPost, "/graphql",
+			strings.NewReader(`{"query": "{ ticket_count }", "variables": {"pad": "`+strings.Repeat("x", maxGraphQLBody)+`"}}`)),
+	}
+	for name, r := range requests {
+		rec := httptest.NewRecorder()
+		handleGraphQL(rec, r)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", name, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/loxhness/LogLens/analytics"
+	"github.com/loxhness/LogLens/ingest"
+)
+
+// maxIngestBody caps a POST /api/tickets body
+const maxIngestBody = 10 << 20
+
+// IngestResult is the response to POST /api/tickets
+type IngestResult struct {
+	Accepted int `json:"accepted"` // new tickets
+	Updated  int `json:"updated"`  // replaced an already loaded ID
+	// Duplicates counts IDs pushed more than once or already loaded,
+	// handled by -duplicates
+	Duplicates int               `json:"duplicates"`
+	Dropped    int               `json:"dropped"`
+	Issues     []ingest.RowIssue `json:"issues"`
+	Tickets    int               `json:"tickets"` // loaded after the ingest
+	Appended   bool              `json:"appended"`
+}
+
+// handleIngest accepts one ticket object or an array of them, with the
+// same field names and validation as a JSON Lines data file. Tickets whose
+// ID is already loaded are handled by -duplicates, as a later file in a
+// glob would be; the rest are appended. ?project= picks the project they
+// go to.
+func handleIngest(w http.ResponseWriter, r *http.Request) {
+	p, err := lookupProject(r.URL.Query().Get("project"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var body interface{}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxIngestBody))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		http.Error(w, "Invalid ticket JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var objs []interface{}
+	switch v := body.(type) {
+	case map[string]interface{}:
+		objs = []interface{}{v}
+	case []interface{}:
+		objs = v
+	default:
+		http.Error(w, "Invalid ticket JSON: want an object or an array of objects", http.StatusBadRequest)
+		return
+	}
+
+	pushed, stats, err := loader.ParseObjects(objs)
+	if err != nil {
+		http.Error(w, "Invalid tickets: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := IngestResult{Dropped: stats.Skipped + stats.Rejected + stats.Excluded + stats.Purged,
+		Duplicates: stats.Duplicates, Issues: stats.Issues}
+	if res.Issues == nil {
+		res.Issues = []ingest.RowIssue{}
+	}
+	if len(pushed) == 0 {
+		w.Header().Set("Content-Type", mimeJSON)
+		if len(objs) > 0 && res.Dropped == len(objs) {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		res.Tickets = len(p.currentTickets())
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	// Held through the merge so a concurrent push or load isn't lost. A
+	// reload still replaces everything with the data file (or the store),
+	// so pushed tickets only survive one with -ingest-append or -store.
+	p.updateMu.Lock()
+	defer p.updateMu.Unlock()
+	cur := p.currentTickets()
+	var merge ingest.LoadStats
+	merged, err := loader.Merge(cur, pushed, &merge)
+	if err != nil {
+		http.Error(w, "Rejected tickets: "+err.Error(), http.StatusConflict)
+		return
+	}
+	res.Duplicates += merge.Duplicates
+	res.Accepted = len(merged) - len(cur)
+	if *duplicates == ingest.KeepFirst {
+		// Loaded tickets win, so only new IDs are kept anywhere
+		pushed = newTickets(cur, pushed)
+	} else {
+		res.Updated = merge.Duplicates
+	}
+
+	if p.store != nil && len(pushed) > 0 {
+		if err := p.store.Upsert(pushed); err != nil {
+			logRequestf(r, "Ingest failed: store import: %v", err)
+			http.Error(w, "Failed to store tickets: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if *ingestAppend && len(pushed) > 0 {
+		if err := loader.Append(p.dataPath, p.format, pushed); err != nil {
+			logRequestf(r, "Ingest failed: append to %s: %v", p.dataPath, err)
+			http.Error(w, "Failed to append tickets: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res.Appended = true
+	}
+
+	p.setTickets(merged)
+	res.Tickets = len(merged)
+	logRequestf(r, "%sIngested %d tickets (%d new, %d updated, %d duplicates, %d dropped)",
+		p.label(), len(pushed), res.Accepted, res.Updated, res.Duplicates, res.Dropped)
+
+	w.Header().Set("Content-Type", mimeJSON)
+	json.NewEncoder(w).Encode(res)
+}
+
+// newTickets returns the tickets of add whose IDs cur doesn't hold
+func newTickets(cur, add []analytics.Ticket) []analytics.Ticket {
+	held := make(map[int]bool, len(cur))
+	for _, t := range cur {
+		held[t.ID] = true
+	}
+	var out []analytics.Ticket
+	for _, t := range add {
+		if !held[t.ID] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
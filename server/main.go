@@ -0,0 +1,830 @@
+package server
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+	"github.com/loxhness/LogLens/ingest"
+	"github.com/loxhness/LogLens/store"
+)
+
+// maxUploadBytes caps CSV bodies posted to the API
+const maxUploadBytes = 64 << 20
+
+var (
+	timeLayoutFlags    stringList
+	columnsSpec        = flag.String("columns", "", "map standard columns to source names, e.g. created_at=opened_on,status=state")
+	ingestAppend       = flag.Bool("ingest-append", false, "append tickets pushed to POST /api/tickets to the -data file so reloads keep them")
+	incremental        = flag.Bool("incremental", false, "reloads read only rows appended to -data files, and files newly matching a -data glob, since the last load")
+	watchInterval      = flag.Duration("watch", 0, "poll the data file this often and reload it when it changes (e.g. 5s; 0 disables)")
+	watchDebounce      = flag.Duration("watch-debounce", 2*time.Second, "how long the data file must stay unchanged before -watch reloads it")
+	reportDir          = flag.String("report-dir", "", "directory -report-interval writes PDF reports into")
+	reportInterval     = flag.Duration("report-interval", 0, "write a PDF report of the default project to -report-dir this often (e.g. 24h; 0 disables)")
+	analyzeOut         = flag.String("out", "", "analyze: write the summary to this file instead of stdout; .csv and .ndjson pick those formats")
+	analyzeFields      = flag.String("fields", "", "analyze: comma-separated summary fields to write (default all)")
+	digestPeriod       = flag.String("digest", "", "email a daily or weekly digest of the default project to -digest-to (empty disables)")
+	digestAt           = flag.String("digest-at", "08:00", "time of day (HH:MM in -timezone) digests are sent; weekly ones on -week-start")
+	digestTemplateFile = flag.String("digest-template", "", "text/template file for the digest email instead of the built-in one")
+	alertOpenThreshold = flag.Int("alert-open-threshold", 0, "raise an alert when open tickets exceed this count (0 disables)")
+	alertWebhook       = flag.String("alert-webhook", "", "URL to POST alert JSON to when an alert is raised")
+	alertRulesFile     = flag.String("alert-rules", "", "YAML file of alert rules, each notifying a Slack, Teams or JSON webhook")
+	openSentinels      stringList
+	validPriorities    stringList
+	validStatuses      stringList
+	digestTo           stringList
+	duplicates         = flag.String("duplicates", ingest.KeepLast, "which copy of a ticket ID read more than once a load keeps: keep-first, keep-last, or error to fail the load")
+	validationMode     = flag.String("validation-mode", "flag", "how rows failing -valid-priorities/-valid-statuses are handled: flag (keep) or strict (skip)")
+	anomalyWindow      = flag.Int("anomaly-window", 7, "trailing days used as the baseline for anomaly detection (min 2)")
+	anomalySigma       = flag.Float64("anomaly-sigma", 3, "standard deviations from the trailing mean that flag a day as anomalous")
+	anomalyMethod      = flag.String("anomaly-method", "stddev", "anomaly baseline: stddev (trailing mean and standard deviation) or mad (median and median absolute deviation)")
+	weekStartFlag      = flag.String("week-start", "monday", "first day of the week for weekly buckets: monday or sunday")
+	granularity        = flag.String("granularity", "week", "period used by period-over-period metrics: day, week or month")
+	timezone           = flag.String("timezone", "UTC", "IANA time zone used to interpret dates and bucket days")
+	asOf               = flag.String("as-of", "", "reference time (YYYY-MM-DD or RFC3339) for ages and trailing windows; defaults to now")
+	slaSpec            = flag.String("sla", "High=24h,Medium=72h,Low=168h", "per-priority resolution targets as Priority=duration pairs")
+	slaFile            = flag.String("sla-file", "", "JSON file of priority to target duration, e.g. {\"P1\": \"4h\"}; replaces -sla")
+	urgentPriorities   = stringList{"High"}
+	closedStatuses     = stringList{"Closed", "Resolved", "Done"}
+	openRule           = flag.String("open-rule", "closedat", "what makes a ticket closed: closedat, status (-closed-statuses) or both")
+	urgentLimit        = flag.Int("urgent-limit", 10, "maximum number of urgent_open_tickets to list")
+	atRiskFraction     = flag.Float64("at-risk-fraction", 0.8, "fraction of its SLA an open ticket must reach to be listed in at_risk_tickets")
+	cacheTTL           = flag.Duration("cache-ttl", time.Minute, "how long identical /api/summary responses are served from memory between loads (0 disables caching and ETags)")
+	responseMaxAge     = flag.Int("response-max-age", 0, "Cache-Control max-age in seconds for /api/summary (0 sends no-cache)")
+	capResolutionHours = flag.Float64("cap-resolution-hours", 0, "clamp each resolution time to this many hours before averaging (0 disables)")
+	failOnMetricError  = flag.Bool("fail-on-metric-error", false, "return 500 instead of a partial summary when a metric fails")
+	retainDays         = flag.Int("retain-days", 0, "drop tickets created more than N days before the reference time (0 keeps all)")
+	maxIngestGap       = flag.Duration("max-ingest-gap", 0, "set ingest_stalled when the newest ticket is older than this (e.g. 24h; 0 disables)")
+	baselineFromFlag   = flag.String("baseline-from", "", "start of the baseline window for resolution_vs_baseline (YYYY-MM-DD or RFC3339)")
+	baselineToFlag     = flag.String("baseline-to", "", "end of the baseline window; a bare date includes that whole day")
+	excludeIDsFlag     = flag.String("exclude-ids", "", "comma-separated ticket IDs to drop at load time")
+	excludeIDsFile     = flag.String("exclude-ids-file", "", "file of ticket IDs to drop at load time, one per line or comma-separated; # starts a comment")
+	viewsFile          = flag.String("views-file", "./data/views.json", "JSON file saved views (/api/views) are kept in across restarts (empty keeps them in memory only)")
+	computedFieldsFile = flag.String("computed-fields", "", "file of derived fields, one 'name = expression' per line, computed at load time and usable in group_by")
+	statusHistory      = flag.String("status-history", "", "CSV of status changes (ticket_id, status, timestamp) used for time_in_status")
+)
+
+var (
+	// location is the parsed -timezone; analytics and ingest get a copy
+	location = time.UTC
+	// weekStart is the parsed -week-start
+	weekStart = time.Monday
+	// asOfTime is the parsed -as-of value; zero means use the wall clock
+	asOfTime time.Time
+	// excludedIDs merges -exclude-ids and -exclude-ids-file
+	excludedIDs = make(map[int]bool)
+
+	// analyzer and loader apply the analysis and load-time flags; set by
+	// applyFlags
+	analyzer *analytics.Analyzer
+	loader   *ingest.Loader
+)
+
+func init() {
+	flag.Var(&openSentinels, "open-sentinels", "comma-separated closed_at values that mean the ticket is still open (e.g. OPEN,N/A)")
+	flag.Var(&validPriorities, "valid-priorities", "comma-separated allowed priority values (exact match); empty allows any")
+	flag.Var(&validStatuses, "valid-statuses", "comma-separated allowed status values (exact match); empty allows any")
+	flag.Var(&digestTo, "digest-to", "comma-separated recipients of -digest emails")
+	flag.Var(&closedStatuses, "closed-statuses", "comma-separated status values that mean a ticket is closed")
+	flag.Var(&timeLayoutFlags, "time-layout", "comma-separated extra Go time layouts tried before the built-in ones, e.g. 01/02/2006 15:04")
+	flag.Var(&urgentPriorities, "urgent-priorities", "comma-separated priorities listed in urgent_open_tickets")
+}
+
+// stringList is a flag.Value holding a comma-separated list
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+// Set replaces any default with the parsed list
+func (l *stringList) Set(v string) error {
+	*l = nil
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// applyFlags validates the parsed flags that shape parsing and analysis,
+// exiting on the first bad one, and sets analyzer and loader from them
+func applyFlags() {
+	if *anomalyWindow < 2 {
+		log.Fatalf("Invalid -anomaly-window %d: must be at least 2", *anomalyWindow)
+	}
+	if *anomalySigma <= 0 {
+		log.Fatalf("Invalid -anomaly-sigma %g: must be positive", *anomalySigma)
+	}
+	if !containsExact(analytics.AnomalyMethods, *anomalyMethod) {
+		log.Fatalf("Invalid -anomaly-method %q: want stddev or mad", *anomalyMethod)
+	}
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		log.Fatalf("Invalid -timezone %q: %v", *timezone, err)
+	}
+	location = loc
+	switch strings.ToLower(*weekStartFlag) {
+	case "monday":
+		weekStart = time.Monday
+	case "sunday":
+		weekStart = time.Sunday
+	default:
+		log.Fatalf("Invalid -week-start %q: want monday or sunday", *weekStartFlag)
+	}
+	switch *granularity {
+	case "day", "week", "month":
+	default:
+		log.Fatalf("Invalid -granularity %q: want day, week or month", *granularity)
+	}
+	if config.Format != "csv" && config.Format != "jsonl" {
+		log.Fatalf("Invalid -format %q: want csv or jsonl", config.Format)
+	}
+	switch *openRule {
+	case "closedat", "status", "both":
+	default:
+		log.Fatalf("Invalid -open-rule %q: want closedat, status or both", *openRule)
+	}
+	if *watchInterval < 0 || *watchDebounce < 0 {
+		log.Fatalf("Invalid -watch/-watch-debounce: must not be negative")
+	}
+	if *maxIngestGap < 0 {
+		log.Fatalf("Invalid -max-ingest-gap %s: must not be negative", *maxIngestGap)
+	}
+	if *cacheTTL < 0 {
+		log.Fatalf("Invalid -cache-ttl %s: must not be negative", *cacheTTL)
+	}
+	if *responseMaxAge < 0 {
+		log.Fatalf("Invalid -response-max-age %d: must not be negative", *responseMaxAge)
+	}
+	if *validationMode != "flag" && *validationMode != "strict" {
+		log.Fatalf("Invalid -validation-mode %q: want flag or strict", *validationMode)
+	}
+	if !containsExact(ingest.DuplicatePolicies, *duplicates) {
+		log.Fatalf("Invalid -duplicates %q: want keep-first, keep-last or error", *duplicates)
+	}
+	columnMap, err := ingest.ParseColumnMap(*columnsSpec)
+	if err != nil {
+		log.Fatalf("Invalid -columns: %v", err)
+	}
+	if err := addExcludedIDs(*excludeIDsFlag); err != nil {
+		log.Fatalf("Invalid -exclude-ids: %v", err)
+	}
+	if *excludeIDsFile != "" {
+		data, err := os.ReadFile(*excludeIDsFile)
+		if err != nil {
+			log.Fatalf("Failed to read -exclude-ids-file: %v", err)
+		}
+		if err := addExcludedIDs(string(data)); err != nil {
+			log.Fatalf("Invalid -exclude-ids-file %s: %v", *excludeIDsFile, err)
+		}
+	}
+	var computed []ingest.ComputedField
+	var computedNames []string
+	if *computedFieldsFile != "" {
+		data, err := os.ReadFile(*computedFieldsFile)
+		if err != nil {
+			log.Fatalf("Failed to read -computed-fields: %v", err)
+		}
+		if computed, err = ingest.ParseComputedFields(string(data), analytics.BuiltinGroupKey); err != nil {
+			log.Fatalf("Invalid -computed-fields %s: %v", *computedFieldsFile, err)
+		}
+		for _, f := range computed {
+			computedNames = append(computedNames, f.Name)
+		}
+	}
+	// Set before the time flags below, which parse like the data, and
+	// again once -as-of is known
+	loadOpts := ingest.Options{
+		Location:        location,
+		TimeLayouts:     timeLayoutFlags,
+		Columns:         columnMap,
+		OpenSentinels:   openSentinels,
+		ValidPriorities: validPriorities,
+		ValidStatuses:   validStatuses,
+		Strict:          *validationMode == "strict",
+		ExcludedIDs:     excludedIDs,
+		RetainDays:      *retainDays,
+		Duplicates:      *duplicates,
+		Computed:        computed,
+	}
+	loader = ingest.New(loadOpts)
+
+	if *asOf != "" {
+		t, err := loader.ParseTimestamp(*asOf)
+		if err != nil {
+			log.Fatalf("Invalid -as-of %q: want YYYY-MM-DD or RFC3339", *asOf)
+		}
+		asOfTime = t
+		loadOpts.AsOf = t
+		loader = ingest.New(loadOpts)
+	}
+	if *atRiskFraction <= 0 || *atRiskFraction >= 1 {
+		log.Fatalf("Invalid -at-risk-fraction %g: must be between 0 and 1", *atRiskFraction)
+	}
+	slaTargets, err := analytics.ParseSLA(*slaSpec)
+	if err != nil {
+		log.Fatalf("Invalid -sla: %v", err)
+	}
+	if *slaFile != "" {
+		if slaTargets, err = analytics.ParseSLAFile(*slaFile); err != nil {
+			log.Fatalf("Invalid -sla-file: %v", err)
+		}
+	}
+	if (*baselineFromFlag == "") != (*baselineToFlag == "") {
+		log.Fatalf("Invalid baseline: -baseline-from and -baseline-to must be set together")
+	}
+	var baselineFrom, baselineEnd time.Time
+	if *baselineFromFlag != "" {
+		if baselineFrom, err = loader.ParseTimestamp(*baselineFromFlag); err != nil {
+			log.Fatalf("Invalid -baseline-from %q: want YYYY-MM-DD or RFC3339", *baselineFromFlag)
+		}
+		if baselineEnd, err = loader.ParseTimestamp(*baselineToFlag); err != nil {
+			log.Fatalf("Invalid -baseline-to %q: want YYYY-MM-DD or RFC3339", *baselineToFlag)
+		}
+		if len(*baselineToFlag) == len(analytics.DateLayout) {
+			baselineEnd = baselineEnd.AddDate(0, 0, 1)
+		}
+		if !baselineEnd.After(baselineFrom) {
+			log.Fatalf("Invalid baseline: -baseline-to must be after -baseline-from")
+		}
+	}
+	analyzer = analytics.New(analytics.Settings{
+		Location:           location,
+		WeekStart:          weekStart,
+		Granularity:        *granularity,
+		AsOf:               asOfTime,
+		OpenRule:           *openRule,
+		ClosedStatuses:     closedStatuses,
+		SLATargets:         slaTargets,
+		UrgentPriorities:   urgentPriorities,
+		UrgentLimit:        *urgentLimit,
+		AtRiskFraction:     *atRiskFraction,
+		CapResolutionHours: *capResolutionHours,
+		MaxIngestGap:       *maxIngestGap,
+		BaselineStart:      baselineFrom,
+		BaselineEnd:        baselineEnd,
+		BaselineFrom:       *baselineFromFlag,
+		BaselineTo:         *baselineToFlag,
+		AnomalyWindow:      *anomalyWindow,
+		AnomalySigma:       *anomalySigma,
+		AnomalyMethod:      *anomalyMethod,
+		CurrentAlert:       currentAlert,
+		ComputedFields:     computedNames,
+	})
+}
+
+func Main() {
+	if len(os.Args) > 1 && os.Args[1] == "analyze" {
+		os.Exit(runAnalyze(os.Args[2:]))
+	}
+	flag.Parse()
+	applyFlags()
+
+	if config.StoreMaxConns < 0 {
+		log.Fatalf("Invalid -store-max-conns %d: must not be negative", config.StoreMaxConns)
+	}
+	st, err := store.Open(config.Store, config.StoreDSN, config.StoreMaxConns, location)
+	if err != nil {
+		log.Fatalf("Invalid -store: %v", err)
+	}
+	if remote, err = openSource(config); err != nil {
+		log.Fatalf("Invalid -source: %v", err)
+	}
+	if config.SourceRefresh < 0 {
+		log.Fatalf("Invalid -source-refresh %s: must not be negative", config.SourceRefresh)
+	}
+	if config.ShutdownTimeout <= 0 {
+		log.Fatalf("Invalid -shutdown-timeout %s: must be positive", config.ShutdownTimeout)
+	}
+	if *reportInterval < 0 {
+		log.Fatalf("Invalid -report-interval %s: must not be negative", *reportInterval)
+	}
+	if *reportInterval > 0 && *reportDir == "" {
+		log.Fatalf("Invalid -report-interval: needs -report-dir")
+	}
+	if digestTemplate, err = parseDigestTemplate(*digestTemplateFile); err != nil {
+		log.Fatalf("Invalid -digest-template: %v", err)
+	}
+	digestHour, digestMinute, err := parseClock(*digestAt)
+	if err != nil {
+		log.Fatalf("Invalid -digest-at %q: %v", *digestAt, err)
+	}
+	switch *digestPeriod {
+	case "", "daily", "weekly":
+	default:
+		log.Fatalf("Invalid -digest %q: want daily or weekly", *digestPeriod)
+	}
+	if *digestPeriod != "" && (len(digestTo) == 0 || config.SMTPAddr == "" || config.SMTPFrom == "") {
+		log.Fatalf("Invalid -digest: needs -digest-to, -smtp-addr and -smtp-from")
+	}
+	defaultProject.dataPath, defaultProject.format, defaultProject.historyPath = config.DataPath, config.Format, *statusHistory
+	defaultProject.demo, defaultProject.remote, defaultProject.store = config.Demo, remote, st
+	if config.ProjectsFile != "" {
+		extra, err := parseProjects(config.ProjectsFile)
+		if err != nil {
+			log.Fatalf("Invalid -projects %s: %v", config.ProjectsFile, err)
+		}
+		for _, p := range extra {
+			projects[p.name] = p
+		}
+	}
+	if *viewsFile != "" {
+		if err := loadViews(*viewsFile); err != nil {
+			log.Fatalf("Invalid -views-file %s: %v", *viewsFile, err)
+		}
+	}
+	if *alertRulesFile != "" {
+		rules, err := parseAlertRules(*alertRulesFile)
+		if err == nil {
+			err = setAlertRules(rules)
+		}
+		if err != nil {
+			log.Fatalf("Invalid -alert-rules %s: %v", *alertRulesFile, err)
+		}
+	}
+	if *ingestAppend {
+		for _, p := range sortedProjects() {
+			if p.demo || ingest.IsGlob(p.dataPath) || p.remote != nil {
+				log.Fatalf("Invalid -ingest-append: %sneeds a single -data file, not -demo, a glob or a -source connector", p.label())
+			}
+		}
+		if *duplicates != ingest.KeepLast {
+			log.Fatalf("Invalid -ingest-append: appended updates repeat IDs in the file, which needs -duplicates=keep-last")
+		}
+	}
+	if *incremental && (config.Demo || remote != nil) {
+		log.Fatalf("Invalid -incremental: needs -data files, not -demo or a -source connector")
+	}
+	for _, p := range sortedProjects() {
+		if err := p.load(); err != nil {
+			log.Fatalf("%sFailed to load tickets at startup: %v", p.label(), err)
+		}
+	}
+
+	for _, p := range sortedProjects() {
+		switch {
+		case p.demo:
+		case p.remote != nil:
+			if config.SourceRefresh > 0 {
+				go refreshSource(config.SourceRefresh)
+			}
+		case *watchInterval > 0:
+			go watchData(p, *watchInterval, *watchDebounce)
+		}
+	}
+
+	if *reportInterval > 0 {
+		go scheduleReports(*reportDir, *reportInterval)
+	}
+	if *digestPeriod != "" {
+		go scheduleDigests(*digestPeriod, digestHour, digestMinute)
+	}
+
+	authn, err := parseAuth(config.APIKeys, config.BasicAuth)
+	if err != nil {
+		log.Fatalf("Invalid -basic-auth: %v", err)
+	}
+	if len(authn.keys) > 0 && !authn.hasBasic {
+		log.Printf("Warning: -api-keys protects the API only; the dashboard and its data under %s stay public without -basic-auth", config.StaticDir)
+	}
+	servers := newServers(config, authn)
+	if servers[0].TLSConfig, err = tlsConfig(config); err != nil {
+		log.Fatalf("Invalid TLS settings: %v", err)
+	}
+	if err := runServers(servers, config.ShutdownTimeout); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
+
+// newServers builds the API server for cfg.Addr and, with cfg.MetricsAddr
+// set, a second server carrying only the operational endpoints. Both
+// require the credentials in a, if any.
+func newServers(cfg Config, a *auth) []*http.Server {
+	// Static file server for dashboard
+	api := http.NewServeMux()
+	fs := http.FileServer(http.Dir(cfg.StaticDir))
+	api.Handle("/", fs)
+	if cfg.Demo {
+		api.HandleFunc("/data/tickets.csv", handleDemoCSV)
+	}
+
+	// API endpoints
+	api.HandleFunc("/api/summary", withResponseCache(handleSummary))
+	api.HandleFunc("/api/summary/stream", handleSummaryStream)
+	api.HandleFunc("/api/summary.csv", withFormat("csv", withResponseCache(handleSummary)))
+	api.HandleFunc("/api/reload", handleReload)
+	api.HandleFunc("/api/reload/status", handleReloadStatus)
+	api.HandleFunc("/graphql", handleGraphQL)
+	api.HandleFunc("/ws", handleWebSocket)
+	api.HandleFunc("/api/analyze", handleAnalyze)
+	api.HandleFunc("/api/stale-before", handleStaleBefore)
+	api.HandleFunc("/api/sla/breaches", handleSLABreaches)
+	api.HandleFunc("/api/aggregate", handleAggregate)
+	api.HandleFunc("/api/anomalies", handleAnomalies)
+	api.HandleFunc("/api/forecast", handleForecast)
+	api.HandleFunc("/api/aggregate.csv", withFormat("csv", handleAggregate))
+	api.HandleFunc("/api/tickets", handleTickets)
+	api.HandleFunc("/api/tickets.csv", withFormat("csv", handleTickets))
+	api.HandleFunc("/api/tickets.ndjson", handleTicketsNDJSON)
+	api.HandleFunc("/api/tickets/reopened", handleReopenedTickets)
+	api.HandleFunc("/api/projects", handleProjects)
+	api.HandleFunc("/api/report.xlsx", handleReportXLSX)
+	api.HandleFunc("/api/report.pdf", handleReportPDF)
+	api.HandleFunc("/api/digest", handleDigest)
+	api.HandleFunc("/api/alerts", handleAlerts)
+	api.HandleFunc("/api/categories/", handleCategory)
+	api.HandleFunc("/api/views", handleViews)
+	api.HandleFunc("/api/views/", handleView)
+
+	// Operational endpoints (health, /metrics) move to their own server
+	// with -metrics-addr
+	ops := api
+	if cfg.MetricsAddr != "" {
+		ops = http.NewServeMux()
+	}
+	ops.HandleFunc("/healthz", handleHealthz)
+	ops.HandleFunc("/readyz", handleReadyz)
+	ops.HandleFunc("/metrics", handleMetrics)
+
+	servers := []*http.Server{{Addr: cfg.Addr, Handler: withRequestLogging(withAuth(a, api))}}
+	if cfg.MetricsAddr != "" {
+		servers = append(servers, &http.Server{Addr: cfg.MetricsAddr, Handler: withRequestLogging(withAuth(a, ops))})
+	}
+	return servers
+}
+
+func containsExact(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// addExcludedIDs parses a comma- or newline-separated ID list into
+// excludedIDs, ignoring blank entries and # comments
+func addExcludedIDs(list string) error {
+	for _, line := range strings.Split(list, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		for _, item := range strings.Split(line, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			id, err := strconv.Atoi(item)
+			if err != nil {
+				return fmt.Errorf("invalid ticket ID %q", item)
+			}
+			excludedIDs[id] = true
+		}
+	}
+	return nil
+}
+
+// summaryFor computes the summary of the tickets filter selects, reusing
+// the precomputed full summary when no filter is active
+func summaryFor(filter ticketFilter, opts analytics.Options) analytics.Summary {
+	p := filter.source()
+	var s analytics.Summary
+	if filter.active() {
+		s = analyzer.Compute(filter.tickets(), opts)
+	} else {
+		s = p.fullSummary()
+		analyzer.AddOptIn(p.currentTickets(), &s, opts)
+	}
+	if p != defaultProject {
+		s.Alert = nil // alerts watch the default project only
+	}
+	return s
+}
+
+func handleSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	opts, err := parseSummaryOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	offset, err := intParam(r.URL.Query(), "days_offset")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(r.URL.Query(), "days_limit")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (offset != nil && *offset < 0) || (limit != nil && *limit < 0) {
+		http.Error(w, "days_offset and days_limit must not be negative", http.StatusBadRequest)
+		return
+	}
+	window, err := intParam(r.URL.Query(), "window")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if window != nil && (*window < 2 || *window > analytics.MaxRollingWindow) {
+		http.Error(w, fmt.Sprintf("window must be between 2 and %d days", analytics.MaxRollingWindow), http.StatusBadRequest)
+		return
+	}
+	// The rolling series goes out unless ?fields= leaves it out, and
+	// can't be selected without a window to smooth over
+	rolling := opts.Fields == nil || opts.Fields["tickets_per_day_rolling"] || opts.Fields["rolling_window"]
+	if window == nil && opts.Fields != nil && rolling {
+		http.Error(w, "tickets_per_day_rolling and rolling_window need ?window=N", http.StatusBadRequest)
+		return
+	}
+	if window == nil {
+		rolling = false
+	}
+
+	// Paging and smoothing key off tickets_per_day, so compute it even if
+	// not requested
+	compute := opts
+	if opts.Fields != nil && (offset != nil || limit != nil || rolling) {
+		compute.Fields = map[string]bool{"tickets_per_day": true}
+		for f := range opts.Fields {
+			compute.Fields[f] = true
+		}
+	}
+
+	s := summaryFor(filter, compute)
+	setCacheControl(w)
+	if rolling {
+		s = analyzer.RollingDays(s, *window)
+	}
+	if offset != nil || limit != nil {
+		var o, l int
+		if offset != nil {
+			o = *offset
+		}
+		if limit != nil {
+			l = *limit
+		}
+		s = analytics.PaginateDays(s, o, l)
+	}
+	writeSelected(w, r, s, opts.Fields)
+}
+
+// setCacheControl applies -response-max-age; only used on read-only endpoints
+func setCacheControl(w http.ResponseWriter) {
+	if *responseMaxAge > 0 {
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(*responseMaxAge))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+}
+
+// parseSummaryOptions reads the query params that choose summary metrics
+func parseSummaryOptions(q url.Values) (analytics.Options, error) {
+	fields, err := parseFields(q)
+	if err != nil {
+		return analytics.Options{}, err
+	}
+	opts := analytics.Options{Fields: fields, Hierarchical: boolParam(q, "hierarchical")}
+	if opts.Hierarchical && fields != nil {
+		fields["category_tree"] = true
+	}
+	return opts, nil
+}
+
+// boolParam treats 1/true/yes as set
+func boolParam(q url.Values, name string) bool {
+	switch strings.ToLower(q.Get(name)) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+// parseFields reads ?fields=; nil means every field
+func parseFields(q url.Values) (map[string]bool, error) {
+	raw := q.Get("fields")
+	if raw == "" {
+		return nil, nil
+	}
+	fields := make(map[string]bool)
+	for _, f := range strings.Split(raw, ",") {
+		f = strings.TrimSpace(f)
+		if !analytics.KnownField(f) {
+			return nil, fmt.Errorf("Unknown field: %s", f)
+		}
+		fields[f] = true
+	}
+	return fields, nil
+}
+
+// writeSelected writes s, trimmed to fields when a subset was requested
+func writeSelected(w http.ResponseWriter, r *http.Request, s analytics.Summary, fields map[string]bool) {
+	if s.Partial && *failOnMetricError {
+		http.Error(w, "Failed to compute metrics: "+strings.Join(s.FailedMetrics, ", "), http.StatusInternalServerError)
+		return
+	}
+	if fields == nil {
+		writeSummary(w, r, s)
+		return
+	}
+	out, err := analytics.SelectFields(s, fields)
+	if err != nil {
+		http.Error(w, "Failed to encode summary: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeSummary(w, r, out)
+}
+
+// handleAnalyze computes a summary for uploaded tickets without replacing
+// the loaded ones. The body is read as -format unless Content-Type says
+// text/csv or NDJSON.
+func handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	opts, err := parseSummaryOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := config.Format
+	switch mediaType(r.Header.Get("Content-Type")) {
+	case mimeCSV:
+		format = "csv"
+	case mimeNDJSON, mimeJSONL:
+		format = "jsonl"
+	}
+	parsed, _, err := loader.Parse(http.MaxBytesReader(w, r.Body, maxUploadBytes), format)
+	if err != nil {
+		http.Error(w, "Failed to parse tickets: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSelected(w, r, analyzer.Compute(filter.apply(parsed), opts), opts.Fields)
+}
+
+// handleReload reloads the CSV. ?return=status (the default) answers with
+// a small status object; ?return=summary with the recomputed summary.
+// ?full=1 rereads the whole data file under -incremental.
+func handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ret := r.URL.Query().Get("return")
+	if ret == "" {
+		ret = "status"
+	}
+	if ret != "status" && ret != "summary" {
+		http.Error(w, "Invalid return: want summary or status", http.StatusBadRequest)
+		return
+	}
+	p, err := lookupProject(r.URL.Query().Get("project"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if boolParam(r.URL.Query(), "full") {
+		p.mu.Lock()
+		p.offsets = nil
+		p.mu.Unlock()
+	}
+	err = p.load()
+	if err != nil {
+		logRequestf(r, "%sReload failed: %v", p.label(), err)
+		if ret == "summary" {
+			http.Error(w, "Failed to reload CSV: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if ret == "summary" {
+		json.NewEncoder(w).Encode(p.fullSummary())
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(struct {
+		Reloaded bool `json:"reloaded"`
+		*LoadReport
+	}{err == nil, p.lastLoadReport()})
+}
+
+// LoadReport is the outcome of one load attempt. On failure the counts
+// cover whatever was parsed before the error, and Tickets is still the
+// previously loaded set.
+type LoadReport struct {
+	OK         bool      `json:"ok"`
+	Error      string    `json:"error,omitempty"`
+	Source     string    `json:"source"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMS float64   `json:"duration_ms"`
+	Tickets    int       `json:"tickets"` // loaded after the attempt
+	ingest.LoadStats
+}
+
+// handleReloadStatus returns the report of the most recent load, whether
+// from startup, /api/reload or -watch
+func handleReloadStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, err := lookupProject(r.URL.Query().Get("project"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rep := p.lastLoadReport()
+	if rep == nil {
+		http.Error(w, "No load has run yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
+
+// handleStaleBefore lists tickets created before ?date= that are still open,
+// oldest first
+func handleStaleBefore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	raw := r.URL.Query().Get("date")
+	if raw == "" {
+		http.Error(w, "Missing date parameter", http.StatusBadRequest)
+		return
+	}
+	before, err := loader.ParseTimestamp(raw)
+	if err != nil {
+		http.Error(w, "Invalid date: "+raw, http.StatusBadRequest)
+		return
+	}
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := analyzer.ReferenceTime()
+	stale := []analytics.OpenTicket{}
+	for _, t := range filter.tickets() {
+		if !analyzer.IsClosed(t) && t.CreatedAt.Before(before) {
+			stale = append(stale, analyzer.NewOpenTicket(t, now))
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].AgeHours > stale[j].AgeHours })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Date    string                 `json:"date"`
+		Count   int                    `json:"count"`
+		Tickets []analytics.OpenTicket `json:"tickets"`
+	}{raw, len(stale), stale})
+}
+
+// handleHealthz reports that the process is up
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// handleReadyz reports ready only once every project's tickets are loaded
+// and its summary cache is warm
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	for _, p := range sortedProjects() {
+		if atomic.LoadInt32(&p.ready) == 0 {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.Write([]byte("ready\n"))
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Load counters for /metrics, updated atomically by every project's load
+var (
+	loadsTotal        int64
+	loadFailuresTotal int64
+)
+
+// recordLoad counts a finished load of any project
+func recordLoad(err error) {
+	if err != nil {
+		atomic.AddInt64(&loadFailuresTotal, 1)
+		return
+	}
+	atomic.AddInt64(&loadsTotal, 1)
+}
+
+// handleMetrics writes ticket and load gauges in the Prometheus text
+// exposition format. They describe the default project, apart from
+// loglens_project_tickets.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	p := defaultProject
+	p.mu.RLock()
+	t, stats := p.tickets, p.lastLoad
+	p.mu.RUnlock()
+
+	var buf bytes.Buffer
+	metricHeader(&buf, "loglens_tickets", "gauge", "Tickets currently loaded.")
+	fmt.Fprintf(&buf, "loglens_tickets %d\n", len(t))
+
+	metricHeader(&buf, "loglens_project_tickets", "gauge", "Tickets currently loaded per project.")
+	for _, proj := range sortedProjects() {
+		fmt.Fprintf(&buf, "loglens_project_tickets{project=\"%s\"} %d\n", escapeLabel(proj.name), len(proj.currentTickets()))
+	}
+
+	open, closed := analyzer.CountOpenClosed(t)
+	metricHeader(&buf, "loglens_tickets_by_state", "gauge", "Loaded tickets by open/closed state (per -open-rule).")
+	fmt.Fprintf(&buf, "loglens_tickets_by_state{state=\"open\"} %d\n", open)
+	fmt.Fprintf(&buf, "loglens_tickets_by_state{state=\"closed\"} %d\n", closed)
+
+	byCat := make(map[string]int)
+	for _, ticket := range t {
+		byCat[ticket.Category]++
+	}
+	cats := make([]string, 0, len(byCat))
+	for cat := range byCat {
+		cats = append(cats, cat)
+	}
+	sort.Strings(cats)
+	metricHeader(&buf, "loglens_tickets_by_category", "gauge", "Loaded tickets per category.")
+	for _, cat := range cats {
+		fmt.Fprintf(&buf, "loglens_tickets_by_category{category=\"%s\"} %d\n", escapeLabel(cat), byCat[cat])
+	}
+
+	metricHeader(&buf, "loglens_load_rows", "gauge", "Rows seen by the last load, by outcome.")
+	for _, o := range []struct {
+		name string
+		n    int
+	}{
+		{"loaded", stats.Loaded},
+		{"skipped", stats.Skipped},
+		{"rejected", stats.Rejected},
+		{"flagged", stats.Flagged},
+		{"purged", stats.Purged},
+		{"excluded", stats.Excluded},
+		{"duplicate", stats.Duplicates},
+	} {
+		fmt.Fprintf(&buf, "loglens_load_rows{outcome=\"%s\"} %d\n", o.name, o.n)
+	}
+
+	metricHeader(&buf, "loglens_last_load_timestamp_seconds", "gauge", "Unix time of the last successful load.")
+	var loadedAt float64
+	if !stats.LoadedAt.IsZero() {
+		loadedAt = float64(stats.LoadedAt.UnixNano()) / 1e9
+	}
+	fmt.Fprintf(&buf, "loglens_last_load_timestamp_seconds %.3f\n", loadedAt)
+
+	metricHeader(&buf, "loglens_loads_total", "counter", "Completed loads, including reloads.")
+	fmt.Fprintf(&buf, "loglens_loads_total %d\n", atomic.LoadInt64(&loadsTotal))
+	metricHeader(&buf, "loglens_load_failures_total", "counter", "Loads that failed.")
+	fmt.Fprintf(&buf, "loglens_load_failures_total %d\n", atomic.LoadInt64(&loadFailuresTotal))
+
+	metricHeader(&buf, "loglens_ready", "gauge", "1 once tickets are loaded and the summary is precomputed.")
+	fmt.Fprintf(&buf, "loglens_ready %d\n", atomic.LoadInt32(&p.ready))
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func metricHeader(buf *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// labelEscaper escapes label values per the exposition format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
@@ -0,0 +1,428 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+	"github.com/loxhness/LogLens/ingest"
+	"github.com/loxhness/LogLens/store"
+)
+
+// defaultProjectName selects the -data/-source dataset in ?project=
+const defaultProjectName = "default"
+
+// dataset is one project: its tickets, cached summary, summary streams and
+// load lifecycle. The default project is what -data, -source,
+// -demo and -store describe; -projects adds more, each read from its own
+// file.
+type dataset struct {
+	name        string
+	dataPath    string
+	format      string
+	historyPath string
+	demo        bool
+	remote      ticketSource // default project only
+	store       store.Store  // default project only
+
+	hub   *hub
+	cache responseCache
+
+	// updateMu is held by loads and ingests from reading the current
+	// tickets (and offsets) until setTickets, so neither loses the other's
+	// update and two incremental loads don't read the same rows
+	updateMu sync.Mutex
+
+	mu       sync.RWMutex
+	tickets  []analytics.Ticket
+	lastLoad ingest.LoadStats
+	// offsets is where the last load stopped reading each data file;
+	// under -incremental the next load resumes there
+	offsets ingest.Offsets
+	// lastReport describes the most recent load attempt, failed or not
+	lastReport *LoadReport
+	// cachedSummary is the unfiltered summary, precomputed on every load
+	cachedSummary *analytics.Summary
+	// generation counts setTickets calls, so caches can tell when the
+	// tickets they were built from have been replaced
+	generation uint64
+
+	// ready is set to 1 once the first load and precompute have finished
+	ready int32
+}
+
+var (
+	// defaultProject is set up by main from the deployment flags
+	defaultProject = newDataset(defaultProjectName)
+	// projects holds every project by name, the default one included
+	projects = map[string]*dataset{defaultProjectName: defaultProject}
+)
+
+func newDataset(name string) *dataset {
+	return &dataset{name: name, hub: newHub()}
+}
+
+// projectNamePattern keeps project names safe in URLs, logs and labels
+var projectNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// projectSpec is one entry of the -projects file
+type projectSpec struct {
+	Data          string `json:"data"`
+	Format        string `json:"format"`
+	StatusHistory string `json:"status_history"`
+}
+
+// parseProjects reads the -projects JSON file: an object mapping each
+// project name to its data file (or glob), format and optional status
+// history. Format defaults to -format.
+func parseProjects(path string) ([]*dataset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var specs map[string]projectSpec
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&specs); err != nil {
+		return nil, fmt.Errorf("want {\"name\": {\"data\": \"path\", \"format\": \"csv\"}}: %v", err)
+	}
+	var out []*dataset
+	for name, spec := range specs {
+		if !projectNamePattern.MatchString(name) || name == defaultProjectName {
+			return nil, fmt.Errorf("invalid project name %q: use lowercase letters, digits, - and _, and not %q", name, defaultProjectName)
+		}
+		if spec.Data == "" {
+			return nil, fmt.Errorf("project %s: data is required", name)
+		}
+		if spec.Format == "" {
+			spec.Format = config.Format
+		}
+		if spec.Format != "csv" && spec.Format != "jsonl" {
+			return nil, fmt.Errorf("project %s: invalid format %q: want csv or jsonl", name, spec.Format)
+		}
+		p := newDataset(name)
+		p.dataPath, p.format, p.historyPath = spec.Data, spec.Format, spec.StatusHistory
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out, nil
+}
+
+// sortedProjects returns every project, the default one first
+func sortedProjects() []*dataset {
+	out := []*dataset{defaultProject}
+	var names []string
+	for name := range projects {
+		if name != defaultProjectName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out = append(out, projects[name])
+	}
+	return out
+}
+
+// lookupProject returns the project ?project= names; empty is the default
+func lookupProject(name string) (*dataset, error) {
+	if name == "" {
+		return defaultProject, nil
+	}
+	p, ok := projects[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown project %q", name)
+	}
+	return p, nil
+}
+
+// label prefixes log lines about additional projects with their name
+func (p *dataset) label() string {
+	if p == defaultProject {
+		return ""
+	}
+	return "[" + p.name + "] "
+}
+
+// load reads and parses the project's data file, every file matching its
+// glob, the -source connector, or the generated dataset under -demo. With
+// -incremental, files read before are only read from where the last load
+// stopped, and the new rows are merged into the loaded tickets.
+func (p *dataset) load() (err error) {
+	p.updateMu.Lock()
+	defer p.updateMu.Unlock()
+	started := time.Now()
+	source, format := p.dataPath, p.format
+	var parsed []analytics.Ticket
+	var stats ingest.LoadStats
+	var offsets ingest.Offsets
+	defer func() {
+		recordLoad(err)
+		p.recordReport(source, started, stats, err)
+		evaluateLoadRules(p, err)
+	}()
+
+	switch {
+	case p.demo:
+		source, format = "demo dataset (seed "+strconv.FormatInt(config.DemoSeed, 10)+")", "csv"
+		parsed, stats, err = loader.Parse(bytes.NewReader(demoCSV(config.DemoSeed)), format)
+	case p.remote != nil:
+		source = p.remote.String()
+		var recs []ingest.Record
+		if recs, err = p.remote.fetch(); err != nil {
+			return err
+		}
+		parsed, stats, err = loader.ParseRecords(recs)
+	case *incremental:
+		var paths []string
+		if paths, err = ingest.DataFiles(p.dataPath); err != nil {
+			return err
+		}
+		p.mu.RLock()
+		from := p.offsets
+		p.mu.RUnlock()
+		parsed, stats, offsets, err = loader.ParseFilesFrom(paths, format, from)
+		if err == ingest.ErrRewritten {
+			log.Printf("%s%s changed other than by appending; reading it in full", p.label(), p.dataPath)
+			parsed, stats, offsets, err = loader.ParseFilesFrom(paths, format, nil)
+		}
+		if !ingest.IsGlob(p.dataPath) {
+			stats.Files = nil
+		}
+		if stats.Appended {
+			source = "rows appended to " + source
+		}
+	case ingest.IsGlob(p.dataPath):
+		var paths []string
+		if paths, err = ingest.DataFiles(p.dataPath); err != nil {
+			return err
+		}
+		if len(paths) == 0 && p.store == nil {
+			return fmt.Errorf("no files match %s", p.dataPath)
+		}
+		source = fmt.Sprintf("%d files matching %s", len(paths), p.dataPath)
+		parsed, stats, err = loader.ParseFiles(paths, format)
+	default:
+		var in io.Reader
+		f, ferr := os.Open(p.dataPath)
+		switch {
+		case ferr == nil:
+			defer f.Close()
+			in = f
+		case os.IsNotExist(ferr) && p.store != nil:
+			// Nothing new to import; serve what the store already has
+			source, in = "store", strings.NewReader("")
+		default:
+			return ferr
+		}
+		parsed, stats, err = loader.Parse(in, format)
+	}
+	if err != nil {
+		return err
+	}
+	if p.store != nil {
+		if parsed, err = syncStore(p.store, parsed, &stats); err != nil {
+			return err
+		}
+		source += " via " + config.Store + " store"
+	} else if stats.Appended {
+		if stats.Rows == 0 {
+			return nil // nothing new
+		}
+		if parsed, err = p.mergeAppended(parsed, &stats); err != nil {
+			return err
+		}
+	}
+	if p.historyPath != "" {
+		if err = loader.AttachHistory(parsed, p.historyPath); err != nil {
+			return err
+		}
+	}
+	log.Printf("%sLoaded %d tickets from %s (%d skipped, %d rejected, %d flagged, %d purged, %d excluded, %d duplicates)",
+		p.label(), stats.Loaded, source, stats.Skipped, stats.Rejected, stats.Flagged, stats.Purged, stats.Excluded, stats.Duplicates)
+
+	p.mu.Lock()
+	p.lastLoad = stats
+	p.offsets = offsets
+	p.mu.Unlock()
+	p.setTickets(parsed)
+	return nil
+}
+
+// mergeAppended merges tickets read from appended rows into the loaded
+// ones. An ID already loaded is a duplicate, handled by -duplicates as a
+// later file in a glob would be, and retention is applied again so
+// tickets that have aged out since the last full load go too.
+func (p *dataset) mergeAppended(appended []analytics.Ticket, stats *ingest.LoadStats) ([]analytics.Ticket, error) {
+	merged, err := loader.Merge(p.currentTickets(), appended, stats)
+	if err != nil {
+		return nil, err
+	}
+	if *retainDays > 0 {
+		var purged int
+		merged, purged = ingest.PurgeOlderThan(merged, analyzer.ReferenceTime().AddDate(0, 0, -*retainDays))
+		stats.Purged += purged
+	}
+	stats.Loaded = len(merged)
+	return merged, nil
+}
+
+// setTickets replaces the loaded tickets, then runs alerts, refreshes the
+// cached summary and wakes summary streams. -alert-open-threshold only
+// watches the default project; alert rules name theirs.
+func (p *dataset) setTickets(t []analytics.Ticket) {
+	p.mu.Lock()
+	p.tickets = t
+	p.generation++
+	p.mu.Unlock()
+
+	if p == defaultProject {
+		evaluateAlerts(t)
+	}
+	evaluateRules(p, t)
+
+	// Precompute so no request pays for the full summary after a load
+	full := analyzer.Compute(t, analytics.Options{})
+	if p != defaultProject {
+		full.Alert = nil
+	}
+	p.mu.Lock()
+	p.cachedSummary = &full
+	p.mu.Unlock()
+	atomic.StoreInt32(&p.ready, 1)
+	p.hub.publish()
+}
+
+// currentTickets returns the loaded tickets; callers must not modify the slice
+func (p *dataset) currentTickets() []analytics.Ticket {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.tickets
+}
+
+// ticketGeneration returns the current generation of the loaded tickets
+func (p *dataset) ticketGeneration() uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.generation
+}
+
+// fullSummary returns the precomputed unfiltered summary
+func (p *dataset) fullSummary() analytics.Summary {
+	p.mu.RLock()
+	s := p.cachedSummary
+	p.mu.RUnlock()
+	if s == nil {
+		return analyzer.Compute(p.currentTickets(), analytics.Options{})
+	}
+	return *s
+}
+
+func (p *dataset) recordReport(source string, started time.Time, stats ingest.LoadStats, err error) {
+	rep := &LoadReport{
+		OK:         err == nil,
+		Source:     source,
+		StartedAt:  started,
+		DurationMS: float64(time.Since(started)) / float64(time.Millisecond),
+		LoadStats:  stats,
+	}
+	if err != nil {
+		rep.Error = err.Error()
+	}
+	if rep.Issues == nil {
+		rep.Issues = []ingest.RowIssue{}
+	}
+	if rep.DuplicateIDs == nil {
+		rep.DuplicateIDs = []int{}
+	}
+	p.mu.Lock()
+	rep.Tickets = len(p.tickets)
+	p.lastReport = rep
+	p.mu.Unlock()
+}
+
+func (p *dataset) lastLoadReport() *LoadReport {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.lastReport
+}
+
+// loadAll loads every project. Failures don't stop the others; they come
+// back together in one error.
+func loadAll() error {
+	var failed []string
+	for _, p := range sortedProjects() {
+		if err := p.load(); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", p.name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// ProjectInfo is one entry of GET /api/projects
+type ProjectInfo struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+	Tickets int    `json:"tickets"`
+	Ready   bool   `json:"ready"`
+}
+
+// handleProjects lists the projects ?project= accepts, default first
+func handleProjects(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	out := []ProjectInfo{}
+	for _, p := range sortedProjects() {
+		info := ProjectInfo{Name: p.name, Tickets: len(p.currentTickets()), Ready: atomic.LoadInt32(&p.ready) == 1}
+		if rep := p.lastLoadReport(); rep != nil {
+			info.Source = rep.Source
+		}
+		out = append(out, info)
+	}
+	w.Header().Set("Content-Type", mimeJSON)
+	json.NewEncoder(w).Encode(struct {
+		Projects []ProjectInfo `json:"projects"`
+	}{out})
+}
+
+// syncStore imports freshly parsed tickets into s and returns its full
+// set with the load-time exclusion and retention rules applied to it too,
+// so tickets stored before a rule changed don't slip back in
+func syncStore(s store.Store, parsed []analytics.Ticket, stats *ingest.LoadStats) ([]analytics.Ticket, error) {
+	if err := s.Upsert(parsed); err != nil {
+		return nil, fmt.Errorf("store import: %v", err)
+	}
+	all, err := s.All()
+	if err != nil {
+		return nil, fmt.Errorf("store read: %v", err)
+	}
+	kept := all[:0]
+	for _, t := range all {
+		if !excludedIDs[t.ID] {
+			kept = append(kept, t)
+		}
+	}
+	loader.ComputeFields(kept) // stores don't keep them
+	if *retainDays > 0 {
+		kept, stats.Purged = ingest.PurgeOlderThan(kept, analyzer.ReferenceTime().AddDate(0, 0, -*retainDays))
+	}
+	stats.Loaded = len(kept)
+	return kept, nil
+}
@@ -0,0 +1,350 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// reportFields are the summary keys the downloadable reports are built from
+var reportFields = []string{"total_tickets", "open_tickets", "closed_tickets", "tickets_per_day",
+	"top_categories", "avg_resolution_hours_by_category", "sla", "tickets_by_agent"}
+
+// reportTable is one table of a report: a sheet of the xlsx workbook or a
+// table of the PDF. Cells are strings, ints, float64s, or nil for an empty cell.
+type reportTable struct {
+	title  string
+	header []string
+	rows   [][]interface{}
+}
+
+// reportSummary computes the summary fields the reports need for the
+// tickets filter selects
+func reportSummary(filter ticketFilter) analytics.Summary {
+	fields := make(map[string]bool, len(reportFields))
+	for _, f := range reportFields {
+		fields[f] = true
+	}
+	return summaryFor(filter, analytics.Options{Fields: fields})
+}
+
+// reportTables lays the summary out as the report's tables: volume per
+// day, categories, SLA by priority and agents
+func reportTables(s analytics.Summary) []reportTable {
+	perDay := reportTable{title: "Per day", header: []string{"Date", "Tickets"}}
+	for _, d := range s.TicketsPerDay {
+		perDay.rows = append(perDay.rows, []interface{}{d.Date, d.Count})
+	}
+
+	avg := make(map[string]analytics.CategoryAvgHours, len(s.AvgResolutionHoursByCat))
+	for _, a := range s.AvgResolutionHoursByCat {
+		avg[a.Category] = a
+	}
+	cats := reportTable{title: "Categories", header: []string{"Category", "Tickets",
+		"Avg resolution (h)", "Median (h)", "P90 (h)"}}
+	for _, c := range s.TopCategories {
+		row := []interface{}{c.Category, c.Count, nil, nil, nil}
+		if a, ok := avg[c.Category]; ok {
+			row[2], row[3], row[4] = a.AvgHours, a.MedianHours, a.P90Hours
+		}
+		cats.rows = append(cats.rows, row)
+	}
+
+	sla := reportTable{title: "SLA", header: []string{"Priority", "Target (h)", "Tracked", "Breached", "Breach %"}}
+	for _, p := range s.SLA.ByPriority {
+		sla.rows = append(sla.rows, []interface{}{p.Priority, p.TargetHours, p.Tracked, p.Breached, p.BreachPct})
+	}
+	sla.rows = append(sla.rows, []interface{}{"All", nil, s.SLA.Tracked, s.SLA.Breached, s.SLA.BreachPct})
+
+	agents := reportTable{title: "Agents", header: []string{"Assignee", "Total", "Open", "Closed", "Avg resolution (h)"}}
+	for _, a := range s.TicketsByAgent {
+		row := []interface{}{a.Assignee, a.Total, a.Open, a.Closed, nil}
+		if a.AvgHours != nil {
+			row[4] = *a.AvgHours
+		}
+		agents.rows = append(agents.rows, row)
+	}
+	return []reportTable{perDay, cats, sla, agents}
+}
+
+// reportFilename names a downloaded report after the reference day
+func reportFilename(ext string) string {
+	return fmt.Sprintf("loglens-report-%s.%s", analyzer.ReferenceTime().In(location).Format(analytics.DateLayout), ext)
+}
+
+// handleReportXLSX serves GET /api/report.xlsx: the filtered summary as a
+// workbook with one sheet per report table
+func handleReportXLSX(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := encodeXLSX(reportTables(reportSummary(filter)))
+	if err != nil {
+		logRequestf(r, "Report failed: %v", err)
+		http.Error(w, "Failed to build report", http.StatusInternalServerError)
+		return
+	}
+	setCacheControl(w)
+	w.Header().Set("Content-Type", mimeXLSX)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", reportFilename("xlsx")))
+	w.Write(body)
+}
+
+// Report chart sizes and colours
+const (
+	reportChartDays       = 30
+	reportChartCategories = 8
+)
+
+var (
+	reportBarColor  = [3]float64{0.345, 0.651, 1} // the dashboard's #58a6ff
+	reportFillColor = [3]float64{0.94, 0.95, 0.97}
+)
+
+// pdfReport lays a report out top to bottom, starting a page whenever the
+// next block doesn't fit
+type pdfReport struct {
+	doc pdfDoc
+	y   float64
+}
+
+func (p *pdfReport) need(h float64) {
+	if p.doc.page == nil || p.y-h < pdfMargin {
+		p.doc.newPage()
+		p.y = pdfPageHeight - pdfMargin
+	}
+}
+
+// heading starts a section, keeping it on a page with at least minBody
+// points of what follows
+func (p *pdfReport) heading(title string, minBody float64) {
+	p.need(28 + minBody)
+	p.y -= 18
+	p.doc.text(pdfMargin, p.y, 12, true, title)
+	p.y -= 10
+}
+
+// renderReportPDF renders the summary as a PDF: totals, a tickets-per-day
+// chart, a top-categories chart, then the report tables other than the
+// per-day one, which the chart replaces
+func renderReportPDF(s analytics.Summary, subtitle string) []byte {
+	var p pdfReport
+	width := pdfPageWidth - 2*pdfMargin
+	p.need(0)
+	p.y -= 20
+	p.doc.text(pdfMargin, p.y, 18, true, "LogLens report")
+	p.y -= 16
+	p.doc.text(pdfMargin, p.y, 9, false, subtitle)
+	p.y -= 14
+
+	// Totals
+	boxW := (width - 2*10) / 3
+	p.y -= 48
+	for i, kpi := range []struct {
+		label string
+		n     int
+	}{{"Total tickets", s.TotalTickets}, {"Open", s.OpenTickets}, {"Closed", s.ClosedTickets}} {
+		x := pdfMargin + float64(i)*(boxW+10)
+		p.doc.rect(x, p.y, boxW, 48, reportFillColor)
+		p.doc.text(x+10, p.y+30, 9, false, kpi.label)
+		p.doc.text(x+10, p.y+10, 18, true, strconv.Itoa(kpi.n))
+	}
+
+	// Tickets per day, newest reportChartDays days
+	days := s.TicketsPerDay
+	if len(days) > reportChartDays {
+		days = days[len(days)-reportChartDays:]
+	}
+	p.heading(fmt.Sprintf("Tickets per day (last %d days)", len(days)), 130)
+	if len(days) > 0 {
+		const chartH = 110
+		top := 0
+		for _, d := range days {
+			if d.Count > top {
+				top = d.Count
+			}
+		}
+		base := p.y - chartH
+		p.doc.line(pdfMargin, base, pdfMargin+width, base)
+		slot := width / float64(len(days))
+		for i, d := range days {
+			if top > 0 && d.Count > 0 {
+				h := float64(d.Count) / float64(top) * (chartH - 12)
+				p.doc.rect(pdfMargin+float64(i)*slot+slot*0.15, base, slot*0.7, h, reportBarColor)
+			}
+		}
+		p.doc.text(pdfMargin, p.y-8, 8, false, fmt.Sprintf("max %d", top))
+		p.doc.text(pdfMargin, base-10, 8, false, days[0].Date)
+		p.doc.textRight(pdfMargin+width, base-10, 8, false, days[len(days)-1].Date)
+		p.y = base - 14
+	}
+
+	// Top categories as horizontal bars
+	cats := s.TopCategories
+	if len(cats) > reportChartCategories {
+		cats = cats[:reportChartCategories]
+	}
+	p.heading("Top categories", float64(len(cats))*14)
+	if len(cats) > 0 {
+		const labelW, valueW = 130, 40
+		top := cats[0].Count
+		for _, c := range cats {
+			p.y -= 14
+			p.doc.text(pdfMargin, p.y+3, 9, false, fitText(c.Category, 9, labelW-6))
+			barW := float64(c.Count) / float64(top) * (width - labelW - valueW)
+			p.doc.rect(pdfMargin+labelW, p.y+1, barW, 10, reportBarColor)
+			p.doc.text(pdfMargin+labelW+barW+4, p.y+3, 9, false, strconv.Itoa(c.Count))
+		}
+		p.y -= 4
+	}
+
+	for _, t := range reportTables(s)[1:] {
+		p.table(t, width)
+	}
+	return p.doc.bytes()
+}
+
+// table draws t with a bold header, repeated at the top of each page it
+// runs onto. The first column gets the most room; number columns are
+// right-aligned, header included.
+func (p *pdfReport) table(t reportTable, width float64) {
+	const rowH, size = 14.0, 9.0
+	first := width * 0.34
+	rest := (width - first) / float64(len(t.header)-1)
+	numeric := make([]bool, len(t.header))
+	for c := 1; c < len(t.header); c++ {
+		numeric[c] = true
+		for _, cells := range t.rows {
+			if _, isText := cells[c].(string); isText {
+				numeric[c] = false
+				break
+			}
+		}
+	}
+	row := func(cells []string, bold bool) {
+		for c, text := range cells {
+			x, w := pdfMargin, first
+			if c > 0 {
+				x, w = pdfMargin+first+float64(c-1)*rest, rest
+			}
+			text = fitText(text, size, w-6)
+			if numeric[c] {
+				p.doc.textRight(x+w-4, p.y+4, size, bold, text)
+			} else {
+				p.doc.text(x, p.y+4, size, bold, text)
+			}
+		}
+	}
+	header := func() {
+		p.y -= rowH
+		row(t.header, true)
+		p.doc.line(pdfMargin, p.y, pdfMargin+width, p.y)
+	}
+
+	p.heading(t.title, 3*rowH)
+	header()
+	if len(t.rows) == 0 {
+		p.y -= rowH
+		p.doc.text(pdfMargin, p.y+4, size, false, "No data")
+	}
+	for i, cells := range t.rows {
+		if p.y-rowH < pdfMargin {
+			p.need(pdfPageHeight) // always breaks
+			header()
+		}
+		p.y -= rowH
+		if i%2 == 1 {
+			p.doc.rect(pdfMargin, p.y, width, rowH, reportFillColor)
+		}
+		text := make([]string, len(cells))
+		for c, v := range cells {
+			text[c] = reportCell(v)
+		}
+		row(text, false)
+	}
+	p.y -= 6
+}
+
+// reportCell formats one table cell for the PDF
+func reportCell(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', 1, 64)
+	}
+	return ""
+}
+
+// reportSubtitle describes when, and for which project, a report was made
+func reportSubtitle(p *dataset) string {
+	sub := "Generated " + time.Now().In(location).Format("2006-01-02 15:04 MST")
+	if !asOfTime.IsZero() {
+		sub += " as of " + asOfTime.In(location).Format(analytics.DateLayout)
+	}
+	if p != defaultProject {
+		sub += " - project " + p.name
+	}
+	return sub
+}
+
+// handleReportPDF serves GET /api/report.pdf: the filtered summary as a
+// printable snapshot
+func handleReportPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body := renderReportPDF(reportSummary(filter), reportSubtitle(filter.source()))
+	setCacheControl(w)
+	w.Header().Set("Content-Type", mimePDF)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", reportFilename("pdf")))
+	w.Write(body)
+}
+
+// writeReportFile renders the default project's PDF report into dir,
+// replacing the day's earlier one, and returns its path
+func writeReportFile(dir string) (string, error) {
+	body := renderReportPDF(reportSummary(ticketFilter{}), reportSubtitle(defaultProject))
+	path := filepath.Join(dir, reportFilename("pdf"))
+	// Write beside the target and rename, so readers never see half a file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path, nil
+}
+
+// scheduleReports writes a PDF report into dir every interval
+func scheduleReports(dir string, interval time.Duration) {
+	for range time.Tick(interval) {
+		if path, err := writeReportFile(dir); err != nil {
+			log.Printf("Scheduled report failed: %v", err)
+		} else {
+			log.Printf("Wrote report %s", path)
+		}
+	}
+}
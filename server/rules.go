@@ -0,0 +1,433 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// Alert rule types
+const (
+	ruleOpenBacklog  = "open_backlog"
+	ruleSLABreach    = "sla_breach"
+	ruleReloadFailed = "reload_failed"
+)
+
+// AlertRule is one entry of the -alert-rules file: a condition on a
+// project and the webhook to notify when it starts to hold
+type AlertRule struct {
+	Name string
+	// Type is open_backlog (open tickets exceed Threshold), sla_breach
+	// (open tickets past their SLA target exceed Threshold, 0 by default)
+	// or reload_failed (loading the project's data fails)
+	Type      string
+	Threshold int
+	// Priority and Category narrow the tickets open_backlog and
+	// sla_breach count; empty counts all
+	Priority string
+	Category string
+	Project  string // default when empty
+	Webhook  string
+	Format   string // slack, teams or json (the Alert object)
+}
+
+// ruleState is a rule and its alert while the condition holds
+type ruleState struct {
+	rule    AlertRule
+	project *dataset
+	alert   *analytics.Alert // guarded by rulesMu
+}
+
+var (
+	rulesMu    sync.Mutex
+	alertRules []*ruleState
+)
+
+// parseAlertRules reads the -alert-rules file. It is YAML, limited to what
+// a rule list needs: a top-level "rules:" holding a block sequence of
+// "key: value" mappings with plain or quoted scalars, and # comments.
+//
+//	rules:
+//	  - name: backlog
+//	    type: open_backlog
+//	    threshold: 50
+//	    webhook: https://hooks.slack.com/services/...
+//	    format: slack
+func parseAlertRules(path string) ([]AlertRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	items, err := parseRuleList(string(data))
+	if err != nil {
+		return nil, err
+	}
+	var rules []AlertRule
+	seen := make(map[string]bool)
+	for i, item := range items {
+		r, err := newAlertRule(item)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("rule %d: duplicate name %q", i+1, r.Name)
+		}
+		seen[r.Name] = true
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// parseRuleList parses the YAML subset parseAlertRules accepts into one
+// map per sequence item
+func parseRuleList(text string) ([]map[string]string, error) {
+	var items []map[string]string
+	inRules := false
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(stripYAMLComment(line), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '-' {
+			if trimmed != "rules:" {
+				return nil, fmt.Errorf("line %d: want \"rules:\", got %q", n+1, trimmed)
+			}
+			inRules = true
+			continue
+		}
+		if !inRules {
+			return nil, fmt.Errorf("line %d: entries must follow \"rules:\"", n+1)
+		}
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			items = append(items, make(map[string]string))
+			trimmed = strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))
+			if trimmed == "" {
+				continue
+			}
+		} else if len(items) == 0 {
+			return nil, fmt.Errorf("line %d: want a \"- \" list item", n+1)
+		}
+		colon := strings.Index(trimmed, ":")
+		if colon <= 0 {
+			return nil, fmt.Errorf("line %d: want key: value", n+1)
+		}
+		key := strings.TrimSpace(trimmed[:colon])
+		value, err := yamlScalar(strings.TrimSpace(trimmed[colon+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		item := items[len(items)-1]
+		if _, dup := item[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", n+1, key)
+		}
+		item[key] = value
+	}
+	return items, nil
+}
+
+// stripYAMLComment drops a # comment that starts the line or follows
+// whitespace, outside quotes
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// yamlScalar unquotes a double- or single-quoted scalar; plain ones are
+// returned as they are
+func yamlScalar(s string) (string, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		return strconv.Unquote(s)
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.HasPrefix(s, "\"") || strings.HasPrefix(s, "'"):
+		return "", fmt.Errorf("unterminated quoted value %s", s)
+	case strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{") || strings.HasPrefix(s, "|") || strings.HasPrefix(s, ">"):
+		return "", fmt.Errorf("only scalar values are supported, got %s", s)
+	}
+	return s, nil
+}
+
+// newAlertRule checks one parsed rule and fills in its defaults
+func newAlertRule(item map[string]string) (AlertRule, error) {
+	r := AlertRule{Format: "json"}
+	for key, value := range item {
+		switch key {
+		case "name":
+			r.Name = value
+		case "type":
+			r.Type = value
+		case "threshold":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return r, fmt.Errorf("threshold %q must be a non-negative integer", value)
+			}
+			r.Threshold = n
+		case "priority":
+			r.Priority = value
+		case "category":
+			r.Category = value
+		case "project":
+			r.Project = value
+		case "webhook":
+			r.Webhook = value
+		case "format":
+			r.Format = value
+		default:
+			return r, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	if r.Name == "" {
+		return r, fmt.Errorf("missing name")
+	}
+	switch r.Type {
+	case ruleOpenBacklog, ruleSLABreach, ruleReloadFailed:
+	default:
+		return r, fmt.Errorf("%s: type %q must be open_backlog, sla_breach or reload_failed", r.Name, r.Type)
+	}
+	if u, err := url.Parse(r.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return r, fmt.Errorf("%s: webhook must be an http(s) URL", r.Name)
+	}
+	switch r.Format {
+	case "slack", "teams", "json":
+	default:
+		return r, fmt.Errorf("%s: format %q must be slack, teams or json", r.Name, r.Format)
+	}
+	return r, nil
+}
+
+// setAlertRules installs rules, resolving their projects
+func setAlertRules(rules []AlertRule) error {
+	states := make([]*ruleState, 0, len(rules))
+	for _, r := range rules {
+		p, err := lookupProject(r.Project)
+		if err != nil {
+			return fmt.Errorf("%s: %v", r.Name, err)
+		}
+		states = append(states, &ruleState{rule: r, project: p})
+	}
+	rulesMu.Lock()
+	alertRules = states
+	rulesMu.Unlock()
+	return nil
+}
+
+// evaluateRules checks p's ticket rules after a load
+func evaluateRules(p *dataset, t []analytics.Ticket) {
+	for _, s := range rulesFor(p) {
+		r := s.rule
+		var n int
+		var what string
+		switch r.Type {
+		case ruleOpenBacklog:
+			for _, ticket := range t {
+				if !analyzer.IsClosed(ticket) && r.matches(ticket) {
+					n++
+				}
+			}
+			what = "open tickets"
+		case ruleSLABreach:
+			_, breaches := analyzer.SLABreaches(t, analyzer.ReferenceTime())
+			for _, b := range breaches {
+				if b.Open && r.matches(b.Ticket) {
+					n++
+				}
+			}
+			what = "open tickets past their SLA target"
+		default:
+			continue
+		}
+		if n <= r.Threshold {
+			s.update(nil)
+			continue
+		}
+		what += r.scope()
+		msg := fmt.Sprintf("%d %s exceeds threshold of %d", n, what, r.Threshold)
+		if r.Threshold == 0 {
+			msg = fmt.Sprintf("%d %s", n, what)
+		}
+		s.update(&analytics.Alert{Type: r.Type, Message: msg, Threshold: r.Threshold, Value: n})
+	}
+}
+
+// evaluateLoadRules raises p's reload_failed rules when a load fails and
+// clears them when one succeeds
+func evaluateLoadRules(p *dataset, err error) {
+	for _, s := range rulesFor(p) {
+		if s.rule.Type != ruleReloadFailed {
+			continue
+		}
+		if err == nil {
+			s.update(nil)
+			continue
+		}
+		s.update(&analytics.Alert{Type: ruleReloadFailed, Message: "Loading tickets failed: " + err.Error(), Value: 1})
+	}
+}
+
+func rulesFor(p *dataset) []*ruleState {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	var out []*ruleState
+	for _, s := range alertRules {
+		if s.project == p {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// matches reports whether a ticket is one the rule counts
+func (r AlertRule) matches(t analytics.Ticket) bool {
+	return (r.Priority == "" || strings.EqualFold(t.Priority, r.Priority)) &&
+		(r.Category == "" || strings.EqualFold(t.Category, r.Category))
+}
+
+// scope describes the rule's ticket filter for alert messages
+func (r AlertRule) scope() string {
+	var parts []string
+	if r.Priority != "" {
+		parts = append(parts, "priority "+r.Priority)
+	}
+	if r.Category != "" {
+		parts = append(parts, "category "+r.Category)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+// update records the rule's alert, or clears it when a is nil. Like
+// -alert-webhook, the webhook fires only when the alert is first raised.
+func (s *ruleState) update(a *analytics.Alert) {
+	rulesMu.Lock()
+	raised := a != nil && s.alert == nil
+	cleared := a == nil && s.alert != nil
+	if a != nil {
+		a.Rule = s.rule.Name
+		if s.project != defaultProject {
+			a.Project = s.project.name
+		}
+		a.RaisedAt = time.Now()
+		if s.alert != nil {
+			a.RaisedAt = s.alert.RaisedAt
+		}
+	}
+	s.alert = a
+	rulesMu.Unlock()
+
+	if raised {
+		log.Printf("%sAlert %s raised: %s", s.project.label(), s.rule.Name, a.Message)
+		go notify(s.rule.Webhook, s.rule.Format, *a)
+	} else if cleared {
+		log.Printf("%sAlert %s cleared", s.project.label(), s.rule.Name)
+	}
+}
+
+// notify posts an alert to a webhook in the given format: slack and teams
+// send a message their incoming webhooks display, json the Alert itself
+func notify(webhook, format string, a analytics.Alert) {
+	title := "LogLens alert"
+	if a.Rule != "" {
+		title += " " + a.Rule
+	}
+	if a.Project != "" {
+		title += " [" + a.Project + "]"
+	}
+	var payload interface{} = a
+	switch format {
+	case "slack":
+		payload = map[string]string{"text": "*" + title + "*: " + a.Message}
+	case "teams":
+		payload = map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    title,
+			"title":      title,
+			"text":       a.Message,
+			"themeColor": "D29922",
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to encode alert: %v", err)
+		return
+	}
+	resp, err := alertClient.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Failed to post alert webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Alert webhook returned %s", resp.Status)
+	}
+}
+
+// RuleStatus is one alert rule and its alert, if raised, in /api/alerts.
+// The webhook is left out since it usually embeds a secret.
+type RuleStatus struct {
+	Name      string           `json:"name"`
+	Type      string           `json:"type"`
+	Project   string           `json:"project"`
+	Threshold int              `json:"threshold"`
+	Priority  string           `json:"priority,omitempty"`
+	Category  string           `json:"category,omitempty"`
+	Format    string           `json:"format"`
+	Active    bool             `json:"active"`
+	Alert     *analytics.Alert `json:"alert"`
+}
+
+// handleAlerts serves GET /api/alerts: every -alert-rules rule with its
+// current alert
+func handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rulesMu.Lock()
+	out := make([]RuleStatus, 0, len(alertRules))
+	for _, s := range alertRules {
+		st := RuleStatus{Name: s.rule.Name, Type: s.rule.Type, Project: s.project.name, Threshold: s.rule.Threshold,
+			Priority: s.rule.Priority, Category: s.rule.Category, Format: s.rule.Format, Active: s.alert != nil}
+		if s.alert != nil {
+			a := *s.alert
+			st.Alert = &a
+		}
+		out = append(out, st)
+	}
+	rulesMu.Unlock()
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Active && !out[j].Active })
+	w.Header().Set("Content-Type", mimeJSON)
+	json.NewEncoder(w).Encode(struct {
+		Rules []RuleStatus `json:"rules"`
+	}{out})
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runServers serves every server until one fails or the process receives
+// SIGINT/SIGTERM, then shuts all of them down gracefully, giving in-flight
+// requests up to shutdownTimeout to finish. SIGHUP reloads every project
+// without stopping. It returns the first listener error, or nil after a
+// signal-triggered shutdown.
+func runServers(servers []*http.Server, shutdownTimeout time.Duration) error {
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		srv := srv
+		log.Printf("LogLens running at %s", displayAddr(srv))
+		go func() {
+			// The certificates are already in TLSConfig
+			serve := srv.ListenAndServe
+			if srv.TLSConfig != nil {
+				serve = func() error { return srv.ListenAndServeTLS("", "") }
+			}
+			if err := serve(); err != http.ErrServerClosed {
+				errs <- err
+			}
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var err error
+wait:
+	for {
+		select {
+		case err = <-errs:
+			break wait
+		case sig := <-stop:
+			log.Printf("Received %s, shutting down", sig)
+			break wait
+		case <-hup:
+			// Off the signal loop so a slow source can't delay a shutdown
+			go func() {
+				if err := loadAll(); err != nil {
+					log.Printf("Reload on SIGHUP failed: %v", err)
+				} else {
+					log.Printf("Reloaded on SIGHUP")
+				}
+			}()
+		}
+	}
+
+	// Streams never finish on their own, so end them before waiting
+	for _, p := range sortedProjects() {
+		p.hub.close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if serr := srv.Shutdown(ctx); serr != nil {
+			log.Printf("Shutdown of %s: %v", srv.Addr, serr)
+		}
+	}
+	return err
+}
+
+// displayAddr turns ":8080" into a clickable http://localhost:8080, or
+// https:// when srv serves TLS
+func displayAddr(srv *http.Server) string {
+	scheme := "http://"
+	if srv.TLSConfig != nil {
+		scheme = "https://"
+	}
+	if len(srv.Addr) > 0 && srv.Addr[0] == ':' {
+		return scheme + "localhost" + srv.Addr
+	}
+	return scheme + srv.Addr
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// handleSLABreaches lists tickets that missed their SLA target
+func handleSLABreaches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tracked, breaches := analyzer.SLABreaches(filter.tickets(), analyzer.ReferenceTime())
+	if breaches == nil {
+		breaches = []analytics.SLABreach{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Tracked  int                   `json:"tracked"`
+		Count    int                   `json:"count"`
+		Breaches []analytics.SLABreach `json:"breaches"`
+	}{tracked, len(breaches), breaches})
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/loxhness/LogLens/ingest"
+)
+
+// ticketSource is a remote system tickets are pulled from instead of -data
+type ticketSource interface {
+	// fetch returns every ticket as a record keyed by data file column
+	// names, so it goes through the same validation as a file
+	fetch() ([]ingest.Record, error)
+	String() string
+}
+
+// remote is the -source connector; nil reads -data
+var remote ticketSource
+
+// sourceClient is shared by connectors; the timeout bounds each page
+var sourceClient = &http.Client{Timeout: 30 * time.Second}
+
+// openSource returns the connector cfg.Source names, or nil for "file"
+func openSource(cfg Config) (ticketSource, error) {
+	switch cfg.Source {
+	case "file":
+		return nil, nil
+	case "jira":
+		return newJiraSource(cfg)
+	case "zendesk":
+		return newZendeskSource(cfg)
+	}
+	return nil, fmt.Errorf("unknown source %q: want file, jira or zendesk", cfg.Source)
+}
+
+// refreshSource re-fetches from the connector every interval
+func refreshSource(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := defaultProject.load(); err != nil {
+			log.Printf("Refresh from %s failed: %v", remote, err)
+		}
+	}
+}
+
+// maxRetryAfter is the longest Retry-After a rate-limited request waits
+// out before giving up
+const maxRetryAfter = time.Minute
+
+// getJSON fetches url with the request prepared by auth and decodes the
+// JSON response into v. A 429 with a short Retry-After is retried a few
+// times. Other non-2xx responses become errors carrying the start of the
+// body, which is where APIs explain what went wrong.
+func getJSON(url string, auth func(*http.Request), v interface{}) error {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", mimeJSON)
+		auth(req)
+		resp, err := sourceClient.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < 3 {
+			wait, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+			resp.Body.Close()
+			if err == nil && time.Duration(wait)*time.Second <= maxRetryAfter {
+				log.Printf("Rate limited by %s, retrying in %ds", req.URL.Host, wait)
+				time.Sleep(time.Duration(wait) * time.Second)
+				continue
+			}
+			return fmt.Errorf("GET %s: %s", req.URL.Path, resp.Status)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return fmt.Errorf("GET %s: %s: %s", req.URL.Path, resp.Status, body)
+		}
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+}
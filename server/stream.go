@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// streamKeepalive is how often an idle stream gets a comment line, so
+// proxies don't time the connection out between reloads
+const streamKeepalive = 30 * time.Second
+
+// hub wakes every subscriber when the loaded tickets change. Each
+// subscriber channel holds at most one pending wake-up: a slow client
+// skips intermediate reloads and just sees the latest summary.
+type hub struct {
+	mu     sync.Mutex
+	subs   map[chan struct{}]bool
+	closed bool
+}
+
+// newHub returns the hub a project publishes to after every successful load
+func newHub() *hub {
+	return &hub{subs: make(map[chan struct{}]bool)}
+}
+
+// subscribe returns a channel that receives after each publish and is
+// closed on shutdown
+func (h *hub) subscribe() chan struct{} {
+	ch := make(chan struct{}, 1)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return ch
+	}
+	h.subs[ch] = true
+	return ch
+}
+
+func (h *hub) unsubscribe(ch chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, ch)
+}
+
+func (h *hub) publish() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- struct{}{}:
+		default: // a wake-up is already pending
+		}
+	}
+}
+
+// close ends every subscription, letting streaming handlers return
+func (h *hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		close(ch)
+		delete(h.subs, ch)
+	}
+	h.closed = true
+}
+
+// handleSummaryStream serves the summary as Server-Sent Events: one
+// "summary" event on connect and another after every reload. It takes the
+// same fields and filter parameters as /api/summary.
+func handleSummaryStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	opts, err := parseSummaryOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Subscribe before the first event so a reload in between isn't missed
+	p := filter.source()
+	wake := p.hub.subscribe()
+	defer p.hub.unsubscribe(wake)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	if err := writeSummaryEvent(w, filter, opts); err != nil {
+		logRequestf(r, "Summary stream ended: %v", err)
+		return
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(streamKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case _, ok := <-wake:
+			if !ok {
+				return
+			}
+			if err := writeSummaryEvent(w, filter, opts); err != nil {
+				logRequestf(r, "Summary stream ended: %v", err)
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeSummaryEvent writes one "summary" event. JSON has no raw newlines,
+// so the payload always fits on a single data line.
+func writeSummaryEvent(w http.ResponseWriter, filter ticketFilter, opts analytics.Options) error {
+	s := summaryFor(filter, opts)
+	var v interface{} = s
+	if opts.Fields != nil {
+		sel, err := analytics.SelectFields(s, opts.Fields)
+		if err != nil {
+			return err
+		}
+		v = sel
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: summary\ndata: %s\n\n", data)
+	return err
+}
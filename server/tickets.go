@@ -0,0 +1,413 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+	"github.com/loxhness/LogLens/ingest"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+	// ndjsonFlushEvery is how many streamed lines are written between flushes
+	ndjsonFlushEvery = 500
+	// defaultReopenedLimit is how many tickets /api/tickets/reopened lists
+	defaultReopenedLimit = 50
+)
+
+// ticketFormats lists the representations /api/tickets can produce
+var ticketFormats = []string{mimeJSON, mimeNDJSON, mimeCSV}
+
+// TicketRecord is a streamed ticket with its derived durations
+type TicketRecord struct {
+	analytics.Ticket
+	ResolutionHours *float64 `json:"resolution_hours"` // null while open
+	AgeHours        *float64 `json:"age_hours"`        // null once closed
+	// FirstResponseHours is omitted until the ticket is responded to
+	FirstResponseHours *float64 `json:"first_response_hours,omitempty"`
+}
+
+// ticketCSVHeader is the column order of writeTicketsCSV
+var ticketCSVHeader = []string{"id", "created_at", "closed_at", "category", "priority", "status",
+	"assignee", "tags", "reassignment_count", "reopened_count", "first_response_at",
+	"resolution_hours", "age_hours", "first_response_hours"}
+
+// writeTicketsCSV writes every ticket with its derived durations. Times use
+// RFC 3339 so the file loads back into LogLens.
+func writeTicketsCSV(w http.ResponseWriter, t []analytics.Ticket) {
+	w.Header().Set("Content-Type", mimeCSV)
+	cw := csv.NewWriter(w)
+	cw.Write(ticketCSVHeader)
+	now := analyzer.ReferenceTime()
+	for _, ticket := range t {
+		rec := newTicketRecord(ticket, now)
+		row := []string{
+			strconv.Itoa(rec.ID),
+			rec.CreatedAt.Format(time.RFC3339),
+			"",
+			rec.Category,
+			rec.Priority,
+			rec.Status,
+			rec.Assignee,
+			strings.Join(rec.Tags, ingest.TagSeparator),
+			optionalInt(rec.Reassignments),
+			optionalInt(rec.Reopens),
+			"",
+			optionalFloat(rec.ResolutionHours),
+			optionalFloat(rec.AgeHours),
+			optionalFloat(rec.FirstResponseHours),
+		}
+		if rec.ClosedAt != nil {
+			row[2] = rec.ClosedAt.Format(time.RFC3339)
+		}
+		if rec.FirstResponseAt != nil {
+			row[10] = rec.FirstResponseAt.Format(time.RFC3339)
+		}
+		if err := cw.Write(row); err != nil {
+			return
+		}
+	}
+	cw.Flush()
+}
+
+func optionalInt(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+func optionalFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func newTicketRecord(t analytics.Ticket, now time.Time) TicketRecord {
+	rec := TicketRecord{Ticket: t}
+	if hours, ok := analyzer.ResolutionHours(t); ok {
+		rec.ResolutionHours = &hours
+	} else if !analyzer.IsClosed(t) {
+		age := now.Sub(t.CreatedAt).Hours()
+		rec.AgeHours = &age
+	}
+	if hours, ok := analytics.FirstResponseHours(t); ok {
+		rec.FirstResponseHours = &hours
+	}
+	return rec
+}
+
+// TicketPage is one page of /api/tickets
+type TicketPage struct {
+	Tickets    []analytics.Ticket `json:"tickets"`
+	Page       int                `json:"page"`
+	PageSize   int                `json:"page_size"`
+	Total      int                `json:"total"`
+	TotalPages int                `json:"total_pages"`
+	Links      PageLinks          `json:"links"`
+}
+
+// PageLinks are absolute URLs to neighbouring pages; Next and Prev are null
+// at the boundaries
+type PageLinks struct {
+	Self  string  `json:"self"`
+	First string  `json:"first"`
+	Last  string  `json:"last"`
+	Next  *string `json:"next"`
+	Prev  *string `json:"prev"`
+}
+
+// handleTickets lists the loaded tickets, filtered and paginated via
+// ?page= (1-based) and ?page_size=. NDJSON or CSV (by Accept or ?format=)
+// returns every matching ticket instead. POST pushes tickets (handleIngest).
+func handleTickets(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		handleIngest(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	filter, err := parseFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	less, err := ticketOrder(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := responseFormat(r, ticketFormats)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	matched := sortedTickets(filter.tickets(), less)
+
+	w.Header().Set("Vary", "Accept")
+	switch format {
+	case mimeNDJSON:
+		streamTickets(w, matched)
+		return
+	case mimeCSV:
+		writeTicketsCSV(w, matched)
+		return
+	}
+	page, size, err := pageParams(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	totalPages := (len(matched) + size - 1) / size
+	if totalPages == 0 {
+		totalPages = 1
+	}
+	start := (page - 1) * size
+	if start > len(matched) {
+		start = len(matched)
+	}
+	end := start + size
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	out := TicketPage{
+		Tickets:    append([]analytics.Ticket{}, matched[start:end]...),
+		Page:       page,
+		PageSize:   size,
+		Total:      len(matched),
+		TotalPages: totalPages,
+		Links: PageLinks{
+			Self:  pageURL(r, page, size),
+			First: pageURL(r, 1, size),
+			Last:  pageURL(r, totalPages, size),
+		},
+	}
+	if page < totalPages {
+		next := pageURL(r, page+1, size)
+		out.Links.Next = &next
+	}
+	if page > 1 {
+		prev := pageURL(r, page-1, size)
+		if page > totalPages {
+			prev = out.Links.Last
+		}
+		out.Links.Prev = &prev
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false) // keep & in links readable
+	enc.Encode(out)
+}
+
+// pageParams reads ?page= and ?page_size=, applying defaults and bounds
+func pageParams(q url.Values) (page, size int, err error) {
+	page, size = 1, defaultPageSize
+	if p, err := intParam(q, "page"); err != nil {
+		return 0, 0, err
+	} else if p != nil {
+		if *p < 1 {
+			return 0, 0, fmt.Errorf("invalid page %d: must be at least 1", *p)
+		}
+		page = *p
+	}
+	if n, err := intParam(q, "page_size"); err != nil {
+		return 0, 0, err
+	} else if n != nil {
+		if *n < 1 || *n > maxPageSize {
+			return 0, 0, fmt.Errorf("invalid page_size %d: must be between 1 and %d", *n, maxPageSize)
+		}
+		size = *n
+	}
+	return page, size, nil
+}
+
+// pageURL rebuilds the request URL with page and page_size replaced,
+// keeping every other query parameter
+func pageURL(r *http.Request, page, size int) string {
+	q := r.URL.Query()
+	q.Set("page", strconv.Itoa(page))
+	q.Set("page_size", strconv.Itoa(size))
+	u := url.URL{Scheme: requestScheme(r), Host: r.Host, Path: r.URL.Path, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// requestScheme is the scheme the client used: X-Forwarded-Proto under
+// -trust-proxy when it names http or https, else whether r came over TLS
+func requestScheme(r *http.Request) string {
+	if config.TrustProxy {
+		if p := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Forwarded-Proto"))); p == "http" || p == "https" {
+			return p
+		}
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// handleTicketsNDJSON is /api/tickets.ndjson, the stream without needing an
+// Accept header
+func handleTicketsNDJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	less, err := ticketOrder(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	streamTickets(w, sortedTickets(filter.tickets(), less))
+}
+
+// ticketSorts are the ?sort= keys /api/tickets accepts. Priority sorts
+// most urgent first; every key falls back to ID to keep pages stable.
+var ticketSorts = map[string]func(a, b analytics.Ticket) bool{
+	"id": func(a, b analytics.Ticket) bool { return a.ID < b.ID },
+	"created_at": func(a, b analytics.Ticket) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	},
+	"priority": func(a, b analytics.Ticket) bool {
+		if a.Priority != b.Priority {
+			return analytics.PriorityLess(a.Priority, b.Priority)
+		}
+		return a.ID < b.ID
+	},
+	"status": func(a, b analytics.Ticket) bool {
+		if sa, sb := strings.ToLower(a.Status), strings.ToLower(b.Status); sa != sb {
+			return sa < sb
+		}
+		return a.ID < b.ID
+	},
+}
+
+// ticketOrder reads ?sort= and ?order=asc|desc; nil means file order
+func ticketOrder(q url.Values) (func(a, b analytics.Ticket) bool, error) {
+	key := q.Get("sort")
+	order := strings.ToLower(q.Get("order"))
+	if order != "" && order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("invalid order %q: want asc or desc", order)
+	}
+	if key == "" {
+		if order != "" {
+			return nil, fmt.Errorf("order needs sort")
+		}
+		return nil, nil
+	}
+	less, ok := ticketSorts[key]
+	if !ok {
+		return nil, fmt.Errorf("invalid sort %q: want id, created_at, priority or status", key)
+	}
+	if order == "desc" {
+		return func(a, b analytics.Ticket) bool { return less(b, a) }, nil
+	}
+	return less, nil
+}
+
+// sortedTickets returns a sorted copy of t, or t itself when less is nil;
+// the loaded slice is shared and must never be reordered in place
+func sortedTickets(t []analytics.Ticket, less func(a, b analytics.Ticket) bool) []analytics.Ticket {
+	if less == nil {
+		return t
+	}
+	out := append([]analytics.Ticket(nil), t...)
+	sort.Slice(out, func(i, j int) bool { return less(out[i], out[j]) })
+	return out
+}
+
+// streamTickets writes one TicketRecord per line, flushing every
+// ndjsonFlushEvery lines so clients can consume as it goes. It stops early
+// if the client goes away.
+func streamTickets(w http.ResponseWriter, t []analytics.Ticket) {
+	w.Header().Set("Content-Type", mimeNDJSON)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	now := analyzer.ReferenceTime()
+	for i, ticket := range t {
+		if err := enc.Encode(newTicketRecord(ticket, now)); err != nil {
+			return
+		}
+		if flusher != nil && (i+1)%ndjsonFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+}
+
+// ReopenedTicket is a ticket listed by /api/tickets/reopened
+type ReopenedTicket struct {
+	TicketRecord
+	ReopenCount int `json:"reopens"` // see analyzer.ReopenCount
+}
+
+// handleReopenedTickets serves GET /api/tickets/reopened: the filtered
+// tickets reopened at least once, most reopens first, up to ?limit=
+func handleReopenedTickets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	filter, err := parseFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultReopenedLimit
+	if n, err := intParam(q, "limit"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if n != nil {
+		if *n < 1 || *n > maxPageSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxPageSize), http.StatusBadRequest)
+			return
+		}
+		limit = *n
+	}
+
+	now := analyzer.ReferenceTime()
+	reopened := []ReopenedTicket{}
+	for _, t := range filter.tickets() {
+		if n, ok := analyzer.ReopenCount(t); ok && n > 0 {
+			reopened = append(reopened, ReopenedTicket{newTicketRecord(t, now), n})
+		}
+	}
+	sort.Slice(reopened, func(i, j int) bool {
+		if reopened[i].ReopenCount != reopened[j].ReopenCount {
+			return reopened[i].ReopenCount > reopened[j].ReopenCount
+		}
+		return reopened[i].ID < reopened[j].ID
+	})
+	total := len(reopened)
+	if total > limit {
+		reopened = reopened[:limit]
+	}
+	w.Header().Set("Content-Type", mimeJSON)
+	json.NewEncoder(w).Encode(struct {
+		Count   int              `json:"count"`
+		Tickets []ReopenedTicket `json:"tickets"`
+	}{total, reopened})
+}
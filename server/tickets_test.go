@@ -0,0 +1,41 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestScheme(t *testing.T) {
+	defer func(trust bool) { config.TrustProxy = trust }(config.TrustProxy)
+	tests := []struct {
+		trust     bool
+		tls       bool
+		forwarded string
+		want      string
+	}{
+		{false, false, "", "http"},
+		{false, true, "", "https"},
+		{false, false, "https", "http"}, // not behind a trusted proxy
+		{false, true, "http", "https"},
+		{true, false, "https", "https"},
+		{true, true, "http", "http"},
+		{true, false, "HTTPS", "https"},
+		{true, false, "javascript", "http"},
+		{true, true, "evil.example/x", "https"},
+	}
+	for _, tt := range tests {
+		config.TrustProxy = tt.trust
+		r := httptest.NewRequest(http.MethodGet, "/api/tickets?page=2", nil)
+		if tt.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-Proto", tt.forwarded)
+		}
+		if got := requestScheme(r); got != tt.want {
+			t.Errorf("trust %v, TLS %v, X-Forwarded-Proto %q: got %s, want %s", tt.trust, tt.tls, tt.forwarded, got, tt.want)
+		}
+	}
+}
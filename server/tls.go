@@ -0,0 +1,43 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// autocertConfig returns a TLS config that obtains and renews certificates
+// for domains from Let's Encrypt, caching them in cacheDir. It is set by
+// tls_autocert.go so the default build needs no third-party modules.
+var autocertConfig func(domains []string, cacheDir, email string) *tls.Config
+
+// tlsConfig returns the TLS config for the dashboard and API server, or nil
+// to serve plain HTTP. -tls-cert/-tls-key and -autocert are exclusive.
+func tlsConfig(cfg Config) (*tls.Config, error) {
+	manual := cfg.TLSCert != "" || cfg.TLSKey != ""
+	switch {
+	case manual && cfg.AutocertDomains != "":
+		return nil, fmt.Errorf("-tls-cert/-tls-key and -autocert are exclusive")
+	case manual:
+		if cfg.TLSCert == "" || cfg.TLSKey == "" {
+			return nil, fmt.Errorf("-tls-cert and -tls-key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+	case cfg.AutocertDomains != "":
+		if autocertConfig == nil {
+			return nil, fmt.Errorf("-autocert is not compiled in (build with -tags autocert)")
+		}
+		var domains []string
+		for _, d := range strings.Split(cfg.AutocertDomains, ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				domains = append(domains, d)
+			}
+		}
+		return autocertConfig(domains, cfg.AutocertCache, cfg.AutocertEmail), nil
+	}
+	return nil, nil
+}
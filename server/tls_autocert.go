@@ -0,0 +1,26 @@
+//go:build autocert
+// +build autocert
+
+package server
+
+import (
+	"crypto/tls"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func init() {
+	autocertConfig = func(domains []string, cacheDir, email string) *tls.Config {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(cacheDir),
+			Email:      email,
+		}
+		// Answers the TLS-ALPN-01 challenge on the HTTPS port itself, so
+		// no port 80 listener is needed
+		c := m.TLSConfig()
+		c.MinVersion = tls.VersionTLS12
+		return c
+	}
+}
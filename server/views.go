@@ -0,0 +1,316 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxViewBody bounds a POST or PUT /api/views body
+const maxViewBody = 64 << 10
+
+// View is a named filter combination saved with /api/views and applied to
+// any filtered endpoint with ?view=name. Empty fields don't filter.
+type View struct {
+	Name       string    `json:"name"`
+	Project    string    `json:"project,omitempty"`
+	From       string    `json:"from,omitempty"`
+	To         string    `json:"to,omitempty"`
+	Categories []string  `json:"categories,omitempty"`
+	Priorities []string  `json:"priorities,omitempty"`
+	Assignee   string    `json:"assignee,omitempty"`
+	Tag        string    `json:"tag,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+var (
+	viewsMu sync.RWMutex
+	// views holds the saved views by name; -views-file keeps them
+	views = map[string]View{}
+)
+
+// params returns the view as the query params parseFilter reads
+func (v View) params() url.Values {
+	q := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			q.Set(name, value)
+		}
+	}
+	set("project", v.Project)
+	set("from", v.From)
+	set("to", v.To)
+	set("assignee", v.Assignee)
+	set("tag", v.Tag)
+	if len(v.Categories) > 0 {
+		q["categories"] = v.Categories
+	}
+	if len(v.Priorities) > 0 {
+		q["priorities"] = v.Priorities
+	}
+	return q
+}
+
+// normalize trims the view's fields and checks them the way a request
+// carrying them would be checked
+func (v *View) normalize() error {
+	v.Name = strings.TrimSpace(v.Name)
+	if !projectNamePattern.MatchString(v.Name) || len(v.Name) > 64 {
+		return fmt.Errorf("invalid view name %q: use up to 64 lowercase letters, digits, - and _", v.Name)
+	}
+	for _, s := range []*string{&v.Project, &v.From, &v.To, &v.Assignee, &v.Tag} {
+		*s = strings.TrimSpace(*s)
+	}
+	var err error
+	if v.Categories, err = viewList("categories", v.Categories); err != nil {
+		return err
+	}
+	if v.Priorities, err = viewList("priorities", v.Priorities); err != nil {
+		return err
+	}
+	_, err = parseFilter(v.params())
+	return err
+}
+
+// viewList trims a view's list and drops empty entries. Filters read lists
+// as comma-separated, so an entry can't hold a comma.
+func viewList(field string, list []string) ([]string, error) {
+	var out []string
+	for _, s := range list {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if strings.Contains(s, ",") {
+			return nil, fmt.Errorf("invalid %s entry %q: must not contain a comma", field, s)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// expandView returns q with the params of the view ?view= names filled in
+// under any given explicitly, which win. q itself is returned without one.
+func expandView(q url.Values) (url.Values, error) {
+	name := strings.TrimSpace(q.Get("view"))
+	if name == "" {
+		return q, nil
+	}
+	viewsMu.RLock()
+	v, ok := views[name]
+	viewsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown view %q", name)
+	}
+	out := v.params()
+	for k, vals := range q {
+		if k != "view" {
+			out[k] = vals
+		}
+	}
+	return out, nil
+}
+
+// loadViews reads the -views-file saved by an earlier run; a missing file
+// means no views yet
+func loadViews(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var list []View
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&list); err != nil {
+		return fmt.Errorf("want a JSON array of views: %v", err)
+	}
+	viewsMu.Lock()
+	defer viewsMu.Unlock()
+	for _, v := range list {
+		if err := v.normalize(); err != nil {
+			return err
+		}
+		if _, dup := views[v.Name]; dup {
+			return fmt.Errorf("view %s is listed twice", v.Name)
+		}
+		views[v.Name] = v
+	}
+	return nil
+}
+
+// sortedViews returns the saved views by name; the caller holds viewsMu
+func sortedViews() []View {
+	out := make([]View, 0, len(views))
+	for _, v := range views {
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// saveViews writes the saved views to -views-file; the caller holds
+// viewsMu. Without the flag views last until the server stops.
+func saveViews() error {
+	if *viewsFile == "" {
+		return nil
+	}
+	body, err := json.MarshalIndent(sortedViews(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(*viewsFile), 0o755); err != nil {
+		return err
+	}
+	// Write beside the file and rename, so a crash never leaves half of it
+	tmp := *viewsFile + ".tmp"
+	if err := os.WriteFile(tmp, append(body, '\n'), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, *viewsFile); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// decodeView reads a view from a request body
+func decodeView(w http.ResponseWriter, r *http.Request) (View, error) {
+	var v View
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxViewBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		return v, fmt.Errorf("Invalid view JSON: %v", err)
+	}
+	if err := v.normalize(); err != nil {
+		return v, err
+	}
+	v.UpdatedAt = time.Now().UTC()
+	return v, nil
+}
+
+// handleViews serves GET /api/views, listing the saved views by name, and
+// POST /api/views, saving a new one. Saving a name already taken is a 409;
+// PUT /api/views/{name} replaces a view.
+func handleViews(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		viewsMu.RLock()
+		list := sortedViews()
+		viewsMu.RUnlock()
+		w.Header().Set("Content-Type", mimeJSON)
+		json.NewEncoder(w).Encode(struct {
+			Views []View `json:"views"`
+		}{list})
+	case http.MethodPost:
+		v, err := decodeView(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		viewsMu.Lock()
+		defer viewsMu.Unlock()
+		if _, ok := views[v.Name]; ok {
+			http.Error(w, fmt.Sprintf("view %s already exists", v.Name), http.StatusConflict)
+			return
+		}
+		if !storeView(w, r, v) {
+			return
+		}
+		w.Header().Set("Location", "/api/views/"+v.Name)
+		writeView(w, http.StatusCreated, v)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleView serves GET, PUT and DELETE /api/views/{name}. PUT creates
+// the view or replaces it whole; a body naming another view is refused.
+func handleView(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/views/")
+	switch r.Method {
+	case http.MethodGet:
+		viewsMu.RLock()
+		v, ok := views[name]
+		viewsMu.RUnlock()
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown view %q", name), http.StatusNotFound)
+			return
+		}
+		writeView(w, http.StatusOK, v)
+	case http.MethodPut:
+		v, err := decodeView(w, r)
+		if err == nil && v.Name != name {
+			err = fmt.Errorf("view name %q does not match the path", v.Name)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		viewsMu.Lock()
+		defer viewsMu.Unlock()
+		_, existed := views[name]
+		if !storeView(w, r, v) {
+			return
+		}
+		status := http.StatusOK
+		if !existed {
+			status = http.StatusCreated
+		}
+		writeView(w, status, v)
+	case http.MethodDelete:
+		viewsMu.Lock()
+		defer viewsMu.Unlock()
+		old, ok := views[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown view %q", name), http.StatusNotFound)
+			return
+		}
+		delete(views, name)
+		if err := saveViews(); err != nil {
+			views[name] = old
+			logRequestf(r, "Deleting view %s failed: %v", name, err)
+			http.Error(w, "Failed to save views: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logRequestf(r, "Deleted view %s", name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// storeView saves v under viewsMu, answering 500 and keeping the previous
+// views when -views-file can't be written
+func storeView(w http.ResponseWriter, r *http.Request, v View) bool {
+	old, existed := views[v.Name]
+	views[v.Name] = v
+	if err := saveViews(); err != nil {
+		if existed {
+			views[v.Name] = old
+		} else {
+			delete(views, v.Name)
+		}
+		logRequestf(r, "Saving view %s failed: %v", v.Name, err)
+		http.Error(w, "Failed to save views: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	logRequestf(r, "Saved view %s", v.Name)
+	return true
+}
+
+func writeView(w http.ResponseWriter, status int, v View) {
+	w.Header().Set("Content-Type", mimeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
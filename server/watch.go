@@ -0,0 +1,68 @@
+package server
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/loxhness/LogLens/ingest"
+)
+
+// watchData polls a project's data file (or glob) every interval and
+// reloads it once it has changed and then stayed unchanged for debounce, so
+// a file being written in several chunks triggers one reload rather than
+// several.
+func watchData(p *dataset, interval, debounce time.Duration) {
+	path := p.dataPath
+	last, _ := statSig(path)
+	var pending bool
+	var changedAt time.Time
+
+	for range time.Tick(interval) {
+		sig, err := statSig(path)
+		if err != nil {
+			continue // mid-replace or removed; look again next tick
+		}
+		if sig != last {
+			last, pending, changedAt = sig, true, time.Now()
+			continue
+		}
+		if !pending || time.Since(changedAt) < debounce {
+			continue
+		}
+		pending = false
+		if err := p.load(); err != nil {
+			log.Printf("%sAuto-reload of %s failed: %v", p.label(), path, err)
+		} else {
+			log.Printf("%sAuto-reloaded %s after change", p.label(), path)
+		}
+	}
+}
+
+// fileSig is what the watcher compares between polls. For a -data glob it
+// covers every match, so adding, removing or changing a file all count.
+type fileSig struct {
+	files   int
+	size    int64
+	modTime time.Time
+}
+
+func statSig(pattern string) (fileSig, error) {
+	paths, err := ingest.DataFiles(pattern)
+	if err != nil {
+		return fileSig{}, err
+	}
+	var sig fileSig
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return fileSig{}, err
+		}
+		sig.files++
+		sig.size += fi.Size()
+		if fi.ModTime().After(sig.modTime) {
+			sig.modTime = fi.ModTime()
+		}
+	}
+	return sig, nil
+}
@@ -0,0 +1,568 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+const (
+	// wsPingInterval is how often /ws pings a connection; one that sends
+	// nothing, not even a pong, for two intervals is dropped
+	wsPingInterval = streamKeepalive
+	// wsWriteTimeout bounds each write, so a stalled client can't hold a
+	// connection open forever
+	wsWriteTimeout = 10 * time.Second
+	// wsMaxMessage bounds a client message; they are short JSON commands
+	wsMaxMessage = 64 << 10
+
+	// wsGUID is the RFC 6455 handshake constant
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// WebSocket opcodes
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// Close status codes sent by /ws
+const (
+	wsCloseGoingAway   = 1001
+	wsCloseProtocol    = 1002
+	wsCloseUnsupported = 1003
+	wsCloseTooBig      = 1009
+)
+
+// wsTopics are what a /ws connection can subscribe to: data (a load or
+// ingest changed the tickets), summary (the summary fields that changed)
+// and sla (the SLA fields of the summary, when they change)
+var wsTopics = []string{"data", "summary", "sla"}
+
+// wsDefaultTopics is what a connection gets without ?topics=
+var wsDefaultTopics = []string{"data", "summary"}
+
+// wsSLAFields are the summary fields the sla topic carries
+var wsSLAFields = []string{"sla", "sla_compliance_trend", "at_risk_tickets"}
+
+// wsEvent is a message /ws sends. Summary and sla events carry in fields
+// only the fields that changed since the connection's last one, unless
+// full is set.
+type wsEvent struct {
+	Type       string                     `json:"type"` // data, summary, sla, subscribed or error
+	Project    string                     `json:"project,omitempty"`
+	Generation uint64                     `json:"generation,omitempty"`
+	Tickets    *int                       `json:"tickets,omitempty"`
+	Full       bool                       `json:"full,omitempty"`
+	Fields     map[string]json.RawMessage `json:"fields,omitempty"`
+	Topics     []string                   `json:"topics,omitempty"`
+	Error      string                     `json:"error,omitempty"`
+}
+
+// wsCommand is a message a /ws client sends to change its subscriptions
+type wsCommand struct {
+	Action string   `json:"action"` // subscribe or unsubscribe
+	Topics []string `json:"topics"`
+}
+
+// wsConn is the server end of a WebSocket connection. Only the handler's
+// goroutine writes; readFrames owns the reading side.
+type wsConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+// wsAccept completes the WebSocket handshake and takes over the
+// connection, or answers the request with an error and returns nil
+func wsAccept(w http.ResponseWriter, r *http.Request) *wsConn {
+	if !headerHas(r.Header, "Connection", "upgrade") || !headerHas(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "want a WebSocket upgrade request", http.StatusBadRequest)
+		return nil
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version: want 13", http.StatusBadRequest)
+		return nil
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil
+	}
+	// Browsers send credentials with cross-site WebSocket requests too, so
+	// only pages served from this host may connect
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !strings.EqualFold(u.Host, r.Host) {
+			http.Error(w, fmt.Sprintf("origin %s not allowed", origin), http.StatusForbidden)
+			return nil
+		}
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil
+	}
+	// Clear any server timeouts; the keepalive sets deadlines from here
+	conn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n")
+	if id := w.Header().Get(requestIDHeader); id != "" {
+		rw.WriteString(requestIDHeader + ": " + id + "\r\n")
+	}
+	rw.WriteString("\r\n")
+	if err := rw.Flush(); err != nil {
+		logRequestf(r, "WebSocket handshake failed: %v", err)
+		conn.Close()
+		return nil
+	}
+	return &wsConn{conn: conn, rw: rw}
+}
+
+// headerHas reports whether the comma-separated header name lists token
+func headerHas(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeFrame sends one unfragmented frame; servers don't mask
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	header := []byte{0x80 | op, 0}
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header[1] = 127
+		header = append(header, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+	c.rw.Write(header)
+	c.rw.Write(payload)
+	return c.rw.Flush()
+}
+
+func (c *wsConn) writeJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(wsText, data)
+}
+
+// writeClose sends a close frame with a status code and reason
+func (c *wsConn) writeClose(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	return c.writeFrame(wsClose, append(payload, reason...))
+}
+
+// wsMessage is a complete message or control frame from the client
+type wsMessage struct {
+	op      byte
+	payload []byte
+}
+
+// wsError is a protocol violation, closed with its status code
+type wsError struct {
+	code   int
+	reason string
+}
+
+func (e *wsError) Error() string { return e.reason }
+
+// readFrames reads client frames into out until the connection fails or
+// done closes, joining fragmented messages. Every frame pushes the read
+// deadline back, so pongs keep an idle connection alive. The error that
+// ended it is sent last.
+func (c *wsConn) readFrames(out chan<- wsMessage, errc chan<- error, done <-chan struct{}) {
+	var msg []byte
+	var msgOp byte
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(2 * wsPingInterval))
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			errc <- err
+			return
+		}
+		switch {
+		case op >= wsClose:
+			// Control frames may arrive between fragments
+		case op == wsContinuation:
+			if msgOp == 0 {
+				errc <- &wsError{wsCloseProtocol, "unexpected continuation frame"}
+				return
+			}
+			if len(msg)+len(payload) > wsMaxMessage {
+				errc <- &wsError{wsCloseTooBig, "message too big"}
+				return
+			}
+			msg = append(msg, payload...)
+			if !fin {
+				continue
+			}
+			op, payload, msg, msgOp = msgOp, msg, nil, 0
+		default:
+			if msgOp != 0 {
+				errc <- &wsError{wsCloseProtocol, "expected a continuation frame"}
+				return
+			}
+			if !fin {
+				msg, msgOp = payload, op
+				continue
+			}
+		}
+		select {
+		case out <- wsMessage{op, payload}:
+		case <-done:
+			return
+		}
+	}
+}
+
+// readFrame reads one frame, unmasking its payload. Clients must mask.
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.rw, head[:]); err != nil {
+		return
+	}
+	fin, op = head[0]&0x80 != 0, head[0]&0x0F
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, &wsError{wsCloseProtocol, "reserved bits set"}
+	}
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, &wsError{wsCloseProtocol, "client frames must be masked"}
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.rw, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.rw, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= wsClose && (!fin || n > 125) {
+		return false, 0, nil, &wsError{wsCloseProtocol, "invalid control frame"}
+	}
+	if n > wsMaxMessage {
+		return false, 0, nil, &wsError{wsCloseTooBig, "message too big"}
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(c.rw, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.rw, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// wsSubscriber is one /ws connection's subscriptions and what it was last
+// sent, so summary and sla events only carry what changed
+type wsSubscriber struct {
+	filter ticketFilter
+	fields map[string]bool // ?fields= for the summary topic; nil is all
+	topics map[string]bool
+	last   map[string]map[string]json.RawMessage // by topic
+}
+
+// parseTopics reads a list of topic names
+func parseTopics(list []string) ([]string, error) {
+	var out []string
+	for _, t := range list {
+		if t = strings.ToLower(strings.TrimSpace(t)); t == "" {
+			continue
+		}
+		if !containsExact(wsTopics, t) {
+			return nil, fmt.Errorf("unknown topic %q: want %s", t, strings.Join(wsTopics, ", "))
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+func (s *wsSubscriber) topicList() []string {
+	var out []string
+	for _, t := range wsTopics {
+		if s.topics[t] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// subscribe adds topics, forgetting what they last sent so their next
+// event is full
+func (s *wsSubscriber) subscribe(topics []string) {
+	for _, t := range topics {
+		s.topics[t] = true
+		delete(s.last, t)
+	}
+}
+
+func (s *wsSubscriber) unsubscribe(topics []string) {
+	for _, t := range topics {
+		delete(s.topics, t)
+		delete(s.last, t)
+	}
+}
+
+// events returns what the subscriber should be sent for the project's
+// current tickets: a data event when asked for, then the summary and sla
+// fields that changed since the last ones
+func (s *wsSubscriber) events(withData bool) ([]wsEvent, error) {
+	p := s.filter.source()
+	var out []wsEvent
+	if withData && s.topics["data"] {
+		n := len(p.currentTickets())
+		out = append(out, wsEvent{Type: "data", Project: p.name, Generation: p.ticketGeneration(), Tickets: &n})
+	}
+	if !s.topics["summary"] && !s.topics["sla"] {
+		return out, nil
+	}
+
+	// Compute only the fields some topic carries
+	var opts analytics.Options
+	if !s.topics["summary"] || s.fields != nil {
+		opts.Fields = make(map[string]bool)
+		for f := range s.fields {
+			opts.Fields[f] = true
+		}
+		if s.topics["sla"] {
+			for _, f := range wsSLAFields {
+				opts.Fields[f] = true
+			}
+		}
+	}
+	data, err := json.Marshal(summaryFor(s.filter, opts))
+	if err != nil {
+		return nil, err
+	}
+	var current map[string]json.RawMessage
+	if err := json.Unmarshal(data, &current); err != nil {
+		return nil, err
+	}
+
+	for _, topic := range []string{"summary", "sla"} {
+		if !s.topics[topic] {
+			continue
+		}
+		keep := s.fields
+		if topic == "sla" {
+			keep = make(map[string]bool)
+			for _, f := range wsSLAFields {
+				keep[f] = true
+			}
+		}
+		last, sent := s.last[topic]
+		ev := wsEvent{Type: topic, Project: p.name, Generation: p.ticketGeneration(), Full: !sent,
+			Fields: make(map[string]json.RawMessage)}
+		next := make(map[string]json.RawMessage)
+		for k, v := range current {
+			if keep != nil && !keep[k] {
+				continue
+			}
+			next[k] = v
+			if !sent || string(last[k]) != string(v) {
+				ev.Fields[k] = v
+			}
+		}
+		s.last[topic] = next
+		if len(ev.Fields) > 0 || !sent {
+			out = append(out, ev)
+		}
+	}
+	return out, nil
+}
+
+// handleWebSocket serves /ws: a WebSocket pushing events to dashboards as
+// the tickets change instead of their polling. ?topics= picks the first
+// subscriptions (default data,summary) and the summary filters and fields
+// apply as on /api/summary/stream. Clients change subscriptions by sending
+// {"action": "subscribe", "topics": ["sla"]} or "unsubscribe"; each change
+// is confirmed with a subscribed event listing the topics now held.
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	sub := &wsSubscriber{topics: make(map[string]bool), last: make(map[string]map[string]json.RawMessage)}
+	var err error
+	if sub.fields, err = parseFields(q); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sub.filter, err = parseFilter(q); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	topics := wsDefaultTopics
+	if raw, ok := q["topics"]; ok {
+		if topics, err = parseTopics(strings.Split(strings.Join(raw, ","), ",")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	sub.subscribe(topics)
+
+	// Subscribe before the first events so a load in between isn't missed
+	p := sub.filter.source()
+	wake := p.hub.subscribe()
+	defer p.hub.unsubscribe(wake)
+
+	c := wsAccept(w, r)
+	if c == nil {
+		return
+	}
+	defer c.conn.Close()
+	logRequestf(r, "WebSocket connected (%s)", strings.Join(sub.topicList(), ", "))
+
+	in := make(chan wsMessage)
+	errc := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go c.readFrames(in, errc, done)
+
+	send := func(withData bool) error {
+		events, err := sub.events(withData)
+		if err != nil {
+			return err
+		}
+		for _, ev := range events {
+			if err := c.writeJSON(ev); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := send(false); err != nil {
+		logRequestf(r, "WebSocket ended: %v", err)
+		return
+	}
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case _, ok := <-wake:
+			if !ok {
+				c.writeClose(wsCloseGoingAway, "server shutting down")
+				return
+			}
+			err = send(true)
+		case <-ping.C:
+			err = c.writeFrame(wsPing, nil)
+		case m := <-in:
+			switch m.op {
+			case wsPing:
+				err = c.writeFrame(wsPong, m.payload)
+			case wsPong:
+				// readFrames already pushed the deadline back
+			case wsClose:
+				c.writeFrame(wsClose, m.payload)
+				logRequestf(r, "WebSocket closed by client")
+				return
+			case wsText:
+				err = handleWSCommand(c, sub, m.payload)
+			default:
+				c.writeClose(wsCloseUnsupported, "want JSON text messages")
+				return
+			}
+		case err = <-errc:
+			var we *wsError
+			if errors.As(err, &we) {
+				c.writeClose(we.code, we.reason)
+			}
+		}
+		if err != nil {
+			logRequestf(r, "WebSocket ended: %v", err)
+			return
+		}
+	}
+}
+
+// handleWSCommand applies a client's subscription change and confirms it.
+// A bad command gets an error event and leaves the connection open.
+func handleWSCommand(c *wsConn, sub *wsSubscriber, payload []byte) error {
+	var cmd wsCommand
+	err := json.Unmarshal(payload, &cmd)
+	var topics []string
+	if err == nil {
+		topics, err = parseTopics(cmd.Topics)
+	}
+	if err == nil {
+		switch cmd.Action {
+		case "subscribe":
+			sub.subscribe(topics)
+		case "unsubscribe":
+			sub.unsubscribe(topics)
+		default:
+			err = fmt.Errorf("unknown action %q: want subscribe or unsubscribe", cmd.Action)
+		}
+	}
+	if err != nil {
+		return c.writeJSON(wsEvent{Type: "error", Error: err.Error()})
+	}
+	if err := c.writeJSON(wsEvent{Type: "subscribed", Topics: sub.topicList()}); err != nil {
+		return err
+	}
+	// Newly subscribed summary and sla topics start with a full event
+	if cmd.Action == "subscribe" {
+		events, err := sub.events(false)
+		if err != nil {
+			return err
+		}
+		for _, ev := range events {
+			if err := c.writeJSON(ev); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
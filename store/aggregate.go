@@ -0,0 +1,302 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// Aggregator is a Store that can group tickets in the database, so
+// /api/aggregate needn't walk every loaded ticket
+type Aggregator interface {
+	Store
+	Aggregate(q AggregateQuery) ([]*analytics.Group, error)
+}
+
+// ErrUntranslatable is returned by Aggregate for a query it can't express
+// in SQL; the caller groups the loaded tickets instead
+var ErrUntranslatable = errors.New("aggregation has no SQL translation")
+
+// AggregateQuery is an analytics.Aggregate call over the stored tickets:
+// the group keys, the request's filters, the load-time rules the served
+// tickets went through and the analysis settings the groups depend on
+type AggregateQuery struct {
+	By []string
+
+	// Zero values don't filter; Until is exclusive
+	MinID, MaxID  *int
+	Assignee, Tag string
+	From, Until   *time.Time
+	// Any of these, ignoring case
+	Categories, Priorities []string
+
+	ExcludedIDs  []int
+	CreatedSince time.Time // -retain-days cutoff; zero keeps all
+
+	Location       *time.Location
+	WeekStart      time.Weekday
+	OpenRule       string // closedat, status or both
+	ClosedStatuses []string
+	CapHours       float64 // 0 leaves resolution times uncapped
+}
+
+// aggregatingStore is a sqlStore on an engine that runs AggregateQuery
+type aggregatingStore struct {
+	*sqlStore
+}
+
+// Aggregate groups the stored tickets as analytics.Aggregate groups the
+// loaded ones. Keys with several values per ticket (tag) and zones the
+// database can't name return ErrUntranslatable, as does what sql lists
+// for SQLite.
+func (s *aggregatingStore) Aggregate(q AggregateQuery) ([]*analytics.Group, error) {
+	query, args, err := q.sql(s.dialect.aggregates)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*analytics.Group
+	for rows.Next() {
+		values := make([]string, len(q.By))
+		dest := make([]interface{}, 0, len(q.By)+4)
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		var count, open, resolved int
+		var hours sql.NullFloat64
+		dest = append(dest, &count, &open, &resolved, &hours)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		groups = append(groups, analytics.NewGroup(values, count, open, resolved, hours.Float64))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Sorted here rather than by ORDER BY, whose collation may not order
+	// ties the way Go compares strings
+	analytics.SortGroups(groups)
+	return groups, nil
+}
+
+// aggregateSyntax is the SQL dialect an engine runs AggregateQuery in
+type aggregateSyntax int
+
+const (
+	noAggregates aggregateSyntax = iota
+	postgresAggregates
+	sqliteAggregates
+)
+
+// sql renders the query in the engine's syntax. Times are stored as RFC
+// 3339 text, which PostgreSQL casts to timestamptz and SQLite's date
+// functions read directly. SQLite knows no zones but UTC, and its lower()
+// folds ASCII only, so local-time keys in other zones, and filters or
+// closed statuses with other letters, have no SQLite translation.
+func (q AggregateQuery) sql(syntax aggregateSyntax) (string, []interface{}, error) {
+	sqlite := syntax == sqliteAggregates
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	if loc.String() == "Local" {
+		return "", nil, ErrUntranslatable
+	}
+	if sqlite {
+		folded := append(append([]string{q.Assignee, q.Tag}, q.Categories...), q.Priorities...)
+		if q.OpenRule == "status" || q.OpenRule == "both" {
+			folded = append(folded, q.ClosedStatuses...)
+		}
+		if !allASCII(folded) {
+			return "", nil, ErrUntranslatable
+		}
+	}
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		// SQLite's ?NNN binds the NNN-th argument like PostgreSQL's $NNN,
+		// so a parameter may appear more than once
+		if sqlite {
+			return "?" + strconv.Itoa(len(args))
+		}
+		return "$" + strconv.Itoa(len(args))
+	}
+	inList := func(col string, values []string) string {
+		if len(values) == 0 {
+			return "FALSE"
+		}
+		marks := make([]string, len(values))
+		for i, v := range values {
+			marks[i] = arg(v)
+		}
+		return col + " IN (" + strings.Join(marks, ", ") + ")"
+	}
+	// instant compares a stored or bound RFC 3339 time by the moment it names
+	instant := func(v string) string {
+		if sqlite {
+			return "unixepoch(" + v + ", 'subsec')"
+		}
+		return v + "::timestamptz"
+	}
+
+	// The zone is only bound when a key uses it, since PostgreSQL
+	// rejects parameters the statement doesn't reference
+	var localCreated string
+	local := func() string {
+		if localCreated == "" {
+			localCreated = "(created_at::timestamptz AT TIME ZONE " + arg(loc.String()) + ")"
+		}
+		return localCreated
+	}
+	keys := make([]string, len(q.By))
+	for i, k := range q.By {
+		switch k {
+		case "category", "priority", "status", "assignee":
+			keys[i] = k
+			continue
+		case "created_day", "created_month", "created_week":
+		default:
+			return "", nil, ErrUntranslatable
+		}
+		if sqlite {
+			// SQLite's date functions give UTC, which is only the local
+			// day in UTC itself
+			if loc != time.UTC && loc.String() != "UTC" {
+				return "", nil, ErrUntranslatable
+			}
+			switch k {
+			case "created_day":
+				keys[i] = "date(created_at)"
+			case "created_month":
+				keys[i] = "strftime('%Y-%m', created_at)"
+			case "created_week":
+				// The latest week-start day on or before the ticket's day
+				keys[i] = "date(created_at, '-6 days', 'weekday " + strconv.Itoa(int(q.WeekStart)) + "')"
+			}
+			continue
+		}
+		switch k {
+		case "created_day":
+			keys[i] = "to_char(" + local() + ", 'YYYY-MM-DD')"
+		case "created_month":
+			keys[i] = "to_char(" + local() + ", 'YYYY-MM')"
+		case "created_week":
+			// date_trunc weeks start on Monday; shift for other week starts
+			shift := strconv.Itoa((int(time.Monday) - int(q.WeekStart) + 7) % 7)
+			keys[i] = "to_char(date_trunc('week', " + local() + " + interval '" + shift + " day') - interval '" + shift + " day', 'YYYY-MM-DD')"
+		}
+	}
+
+	// Only tickets closed with a closed_at have a resolution time
+	closed := "closed_at IS NOT NULL"
+	resolved := closed
+	switch q.OpenRule {
+	case "status":
+		// Statuses match ignoring case, as in analytics.Analyzer.IsClosed
+		closed = inList("lower(status)", lowerAll(q.ClosedStatuses))
+		resolved = "(closed_at IS NOT NULL AND " + closed + ")"
+	case "both":
+		closed = "(closed_at IS NOT NULL AND " + inList("lower(status)", lowerAll(q.ClosedStatuses)) + ")"
+		resolved = closed
+	}
+	hours := "EXTRACT(EPOCH FROM closed_at::timestamptz - created_at::timestamptz) / 3600"
+	least := "LEAST"
+	if sqlite {
+		hours = "(unixepoch(closed_at, 'subsec') - unixepoch(created_at, 'subsec')) / 3600"
+		least = "MIN"
+	}
+	if q.CapHours > 0 {
+		hours = least + "(" + hours + ", " + arg(q.CapHours) + ")"
+	}
+
+	var where []string
+	if q.MinID != nil {
+		where = append(where, "id >= "+arg(*q.MinID))
+	}
+	if q.MaxID != nil {
+		where = append(where, "id <= "+arg(*q.MaxID))
+	}
+	if q.Assignee != "" {
+		where = append(where, "lower(assignee) = lower("+arg(q.Assignee)+")")
+	}
+	if q.Tag != "" {
+		// tags are stored lower-cased and separated by ';'
+		find := "strpos"
+		if sqlite {
+			find = "instr"
+		}
+		where = append(where, find+"(';' || tags || ';', ';' || lower("+arg(q.Tag)+") || ';') > 0")
+	}
+	if len(q.Categories) > 0 {
+		where = append(where, inList("lower(category)", lowerAll(q.Categories)))
+	}
+	if len(q.Priorities) > 0 {
+		where = append(where, inList("lower(priority)", lowerAll(q.Priorities)))
+	}
+	if q.From != nil {
+		where = append(where, instant("created_at")+" >= "+instant(arg(q.From.Format(time.RFC3339Nano))))
+	}
+	if q.Until != nil {
+		where = append(where, instant("created_at")+" < "+instant(arg(q.Until.Format(time.RFC3339Nano))))
+	}
+	if !q.CreatedSince.IsZero() {
+		where = append(where, instant("created_at")+" >= "+instant(arg(q.CreatedSince.Format(time.RFC3339Nano))))
+	}
+	if len(q.ExcludedIDs) > 0 {
+		marks := make([]string, len(q.ExcludedIDs))
+		for i, id := range q.ExcludedIDs {
+			marks[i] = arg(id)
+		}
+		where = append(where, "id NOT IN ("+strings.Join(marks, ", ")+")")
+	}
+
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	for i, k := range keys {
+		fmt.Fprintf(&b, "%s AS k%d, ", k, i)
+	}
+	fmt.Fprintf(&b, "COUNT(*), SUM(CASE WHEN %s THEN 0 ELSE 1 END), SUM(CASE WHEN %s THEN 1 ELSE 0 END), SUM(CASE WHEN %s THEN %s END) FROM tickets",
+		closed, resolved, resolved, hours)
+	if len(where) > 0 {
+		b.WriteString(" WHERE " + strings.Join(where, " AND "))
+	}
+	b.WriteString(" GROUP BY ")
+	for i := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "k%d", i)
+	}
+	return b.String(), args, nil
+}
+
+// allASCII reports whether every value is plain ASCII
+func allASCII(values []string) bool {
+	for _, v := range values {
+		for i := 0; i < len(v); i++ {
+			if v[i] >= utf8.RuneSelf {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func lowerAll(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.ToLower(v)
+	}
+	return out
+}
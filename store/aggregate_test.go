@@ -0,0 +1,138 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+)
+
+// testDSNs gives the parity test a database for each store kind it can
+// reach. Postgres needs LOGLENS_TEST_POSTGRES_DSN, whose tickets table the
+// test empties.
+var testDSNs = map[string]func(t *testing.T) string{
+	"sqlite": func(t *testing.T) string { return filepath.Join(t.TempDir(), "tickets.db") },
+	"postgres": func(t *testing.T) string {
+		dsn := os.Getenv("LOGLENS_TEST_POSTGRES_DSN")
+		if dsn == "" {
+			t.Skip("LOGLENS_TEST_POSTGRES_DSN is not set")
+		}
+		return dsn
+	},
+}
+
+func parityTickets() []analytics.Ticket {
+	at := func(s string) *time.Time {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			panic(err)
+		}
+		return &t
+	}
+	return []analytics.Ticket{
+		{ID: 1, CreatedAt: *at("2026-01-05T10:00:00Z"), ClosedAt: at("2026-01-05T15:00:00Z"), Category: "VPN", Priority: "High", Status: "closed"},
+		{ID: 2, CreatedAt: *at("2026-01-05T11:00:00Z"), Category: "VPN", Priority: "Low", Status: "Open"},
+		{ID: 3, CreatedAt: *at("2026-01-06T23:30:00.25Z"), ClosedAt: at("2026-01-08T01:00:00.5Z"), Category: "Printer", Priority: "High", Status: "RESOLVED"},
+		{ID: 4, CreatedAt: *at("2026-01-07T08:00:00Z"), ClosedAt: at("2026-01-07T09:00:00Z"), Category: "Printer", Priority: "Medium", Status: "In Progress"},
+		{ID: 5, CreatedAt: *at("2026-01-11T12:00:00Z"), Category: "Network", Priority: "Low", Status: "Done"},
+		{ID: 6, CreatedAt: *at("2026-01-12T00:00:00Z"), ClosedAt: at("2026-01-14T00:00:00Z"), Category: "Network", Priority: "High", Status: "Closed"},
+	}
+}
+
+// TestAggregateParity checks that every SQL store compiled in groups
+// tickets as analytics.Analyzer.Aggregate groups the loaded ones
+func TestAggregateParity(t *testing.T) {
+	if len(sqlDrivers) == 0 {
+		t.Skip("no SQL store compiled in; test with -tags sqlite or -tags postgres")
+	}
+	tickets := parityTickets()
+	for kind, d := range sqlDrivers {
+		if d.aggregates == noAggregates {
+			continue
+		}
+		t.Run(kind, func(t *testing.T) {
+			dsn, ok := testDSNs[kind]
+			if !ok {
+				t.Skipf("no test database for %s", kind)
+			}
+			s, err := Open(kind, dsn(t), 1, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			agg := s.(Aggregator)
+			if _, err := agg.(*aggregatingStore).db.Exec(`DELETE FROM tickets`); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Upsert(tickets); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, rule := range []string{"closedat", "status", "both"} {
+				for _, capHours := range []float64{0, 10} {
+					for _, by := range [][]string{{"category"}, {"status"}, {"created_day", "priority"}, {"created_week"}, {"created_month"}} {
+						settings := analytics.DefaultSettings()
+						settings.OpenRule = rule
+						settings.WeekStart = time.Sunday
+						settings.CapResolutionHours = capHours
+						want := analytics.New(settings).Aggregate(tickets, by)
+						analytics.SortGroups(want)
+
+						got, err := agg.Aggregate(AggregateQuery{
+							By:             by,
+							Location:       time.UTC,
+							WeekStart:      settings.WeekStart,
+							OpenRule:       rule,
+							ClosedStatuses: settings.ClosedStatuses,
+							CapHours:       capHours,
+						})
+						if err != nil {
+							t.Fatalf("%s, cap %g, by %v: %v", rule, capHours, by, err)
+						}
+						if msg := diffGroups(got, want); msg != "" {
+							t.Errorf("%s, cap %g, by %v: %s", rule, capHours, by, msg)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+// diffGroups describes the first difference between two sorted group lists
+func diffGroups(got, want []*analytics.Group) string {
+	if len(got) != len(want) {
+		return "got " + groupsString(got) + ", want " + groupsString(want)
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		gh, wh := g.AvgHours(), w.AvgHours()
+		sameHours := (gh == nil) == (wh == nil) && (gh == nil || math.Abs(*gh-*wh) < 1e-6)
+		if groupKey(g) != groupKey(w) || g.Count != w.Count || g.Open != w.Open || !sameHours {
+			return "got " + groupsString(got) + ", want " + groupsString(want)
+		}
+	}
+	return ""
+}
+
+func groupKey(g *analytics.Group) string {
+	return strings.Join(g.Values, "/")
+}
+
+func groupsString(groups []*analytics.Group) string {
+	var parts []string
+	for _, g := range groups {
+		hours := "null"
+		if h := g.AvgHours(); h != nil {
+			hours = strconv.FormatFloat(*h, 'f', 3, 64)
+		}
+		parts = append(parts, fmt.Sprintf("%s: count %d open %d avg %s", groupKey(g), g.Count, g.Open, hours))
+	}
+	return "[" + strings.Join(parts, "; ") + "]"
+}
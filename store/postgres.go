@@ -0,0 +1,24 @@
+//go:build postgres
+// +build postgres
+
+package store
+
+import (
+	// Registers the "postgres" database/sql driver (pure Go)
+	_ "github.com/lib/pq"
+)
+
+func init() {
+	sqlDrivers["postgres"] = sqlDialect{
+		driver: "postgres",
+		upsert: `INSERT INTO tickets
+			(id, created_at, closed_at, category, priority, status, reassignment_count, reopened_count, assignee, tags, first_response_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			ON CONFLICT (id) DO UPDATE SET
+				created_at = EXCLUDED.created_at, closed_at = EXCLUDED.closed_at,
+				category = EXCLUDED.category, priority = EXCLUDED.priority, status = EXCLUDED.status,
+				reassignment_count = EXCLUDED.reassignment_count, reopened_count = EXCLUDED.reopened_count,
+				assignee = EXCLUDED.assignee, tags = EXCLUDED.tags, first_response_at = EXCLUDED.first_response_at`,
+		aggregates: postgresAggregates,
+	}
+}
@@ -0,0 +1,19 @@
+//go:build sqlite
+// +build sqlite
+
+package store
+
+import (
+	// Registers the "sqlite3" database/sql driver (requires cgo)
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	sqlDrivers["sqlite"] = sqlDialect{
+		driver: "sqlite3",
+		upsert: `INSERT OR REPLACE INTO tickets
+			(id, created_at, closed_at, category, priority, status, reassignment_count, reopened_count, assignee, tags, first_response_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		aggregates: sqliteAggregates,
+	}
+}
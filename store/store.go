@@ -0,0 +1,213 @@
+// Package store persists tickets across restarts for the server's -store
+// flag. The default build has only the in-memory store (Open("memory")
+// returns nil), and SQL drivers are compiled in with build tags: sqlite
+// for a local file, postgres for a shared database.
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/loxhness/LogLens/analytics"
+	"github.com/loxhness/LogLens/ingest"
+)
+
+// Store persists tickets across restarts. The data file becomes an
+// import path: each load upserts its tickets, and the in-memory set is
+// whatever the store then holds, so history outlives the export.
+type Store interface {
+	Upsert(t []analytics.Ticket) error
+	All() ([]analytics.Ticket, error)
+	Close() error
+}
+
+// sqlDialect is what differs between the SQL engines a store runs on
+type sqlDialect struct {
+	driver string // database/sql driver name
+	// upsert inserts one ticket or replaces the one with its id, taking
+	// the eleven ticket columns in schema order
+	upsert string
+	// aggregates is the syntax engines that run AggregateQuery in SQL
+	// render it in
+	aggregates aggregateSyntax
+}
+
+// sqlDrivers maps -store names to their dialects. Drivers are registered
+// by build-tagged files so the default build needs no cgo or third-party
+// modules.
+var sqlDrivers = map[string]sqlDialect{}
+
+// Open opens the store named kind at dsn, keeping at most maxConns
+// connections open (0 is unlimited); "memory" returns a nil Store, which
+// keeps tickets in memory only. Tickets read back have their times in
+// loc, as a load gives them.
+func Open(kind, dsn string, maxConns int, loc *time.Location) (Store, error) {
+	if kind == "memory" {
+		return nil, nil
+	}
+	d, ok := sqlDrivers[kind]
+	if !ok {
+		return nil, fmt.Errorf("store %q is not compiled in (build with -tags %s)", kind, kind)
+	}
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(maxConns)
+	if loc == nil {
+		loc = time.UTC
+	}
+	s := &sqlStore{db: db, dialect: d, location: loc}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if d.aggregates != noAggregates {
+		return &aggregatingStore{s}, nil
+	}
+	return s, nil
+}
+
+// sqlStore keeps tickets in a single table. Times are stored as RFC 3339
+// text so the schema works on any SQL engine.
+type sqlStore struct {
+	db       *sql.DB
+	dialect  sqlDialect
+	location *time.Location
+}
+
+func (s *sqlStore) migrate() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS tickets (
+		id                 INTEGER PRIMARY KEY,
+		created_at         TEXT NOT NULL,
+		closed_at          TEXT,
+		category           TEXT NOT NULL,
+		priority           TEXT NOT NULL,
+		status             TEXT NOT NULL,
+		reassignment_count INTEGER,
+		reopened_count     INTEGER,
+		assignee           TEXT NOT NULL DEFAULT '',
+		tags               TEXT NOT NULL DEFAULT '',
+		first_response_at  TEXT
+	)`)
+	if err != nil {
+		return err
+	}
+	// Stores created before these columns existed lack them
+	for _, col := range []struct{ name, def string }{
+		{"tags", "TEXT NOT NULL DEFAULT ''"},
+		{"first_response_at", "TEXT"},
+	} {
+		if _, err := s.db.Exec(`SELECT ` + col.name + ` FROM tickets LIMIT 1`); err != nil {
+			if _, err := s.db.Exec(`ALTER TABLE tickets ADD COLUMN ` + col.name + ` ` + col.def); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Upsert inserts or replaces tickets by ID in one transaction
+func (s *sqlStore) Upsert(t []analytics.Ticket) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(s.dialect.upsert)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, ticket := range t {
+		if _, err := stmt.Exec(ticket.ID, ticket.CreatedAt.Format(time.RFC3339Nano), nullableTime(ticket.ClosedAt),
+			ticket.Category, ticket.Priority, ticket.Status,
+			nullableInt(ticket.Reassignments), nullableInt(ticket.Reopens), ticket.Assignee,
+			strings.Join(ticket.Tags, ingest.TagSeparator), nullableTime(ticket.FirstResponseAt)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// All returns every stored ticket in ID order
+func (s *sqlStore) All() ([]analytics.Ticket, error) {
+	rows, err := s.db.Query(`SELECT id, created_at, closed_at, category, priority, status,
+		reassignment_count, reopened_count, assignee, tags, first_response_at FROM tickets ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []analytics.Ticket
+	for rows.Next() {
+		var t analytics.Ticket
+		var created, tags string
+		var closed, responded sql.NullString
+		var reassign, reopen sql.NullInt64
+		if err := rows.Scan(&t.ID, &created, &closed, &t.Category, &t.Priority, &t.Status,
+			&reassign, &reopen, &t.Assignee, &tags, &responded); err != nil {
+			return nil, err
+		}
+		if t.CreatedAt, err = s.parseTime(created); err != nil {
+			return nil, fmt.Errorf("ticket %d: bad created_at %q in store", t.ID, created)
+		}
+		if t.ClosedAt, err = s.timePtr(closed); err != nil {
+			return nil, fmt.Errorf("ticket %d: bad closed_at %q in store", t.ID, closed.String)
+		}
+		if t.FirstResponseAt, err = s.timePtr(responded); err != nil {
+			return nil, fmt.Errorf("ticket %d: bad first_response_at %q in store", t.ID, responded.String)
+		}
+		t.Reassignments = intPtr(reassign)
+		t.Reopens = intPtr(reopen)
+		t.Tags = ingest.ParseTags(tags)
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func nullableInt(n *int) interface{} {
+	if n == nil {
+		return nil
+	}
+	return *n
+}
+
+func nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// parseTime reads a time as Upsert stores it
+func (s *sqlStore) parseTime(v string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, v)
+	return t.In(s.location), err
+}
+
+func (s *sqlStore) timePtr(v sql.NullString) (*time.Time, error) {
+	if !v.Valid {
+		return nil, nil
+	}
+	t, err := s.parseTime(v.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func intPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int64)
+	return &v
+}